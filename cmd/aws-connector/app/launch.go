@@ -17,6 +17,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	awscfg "github.com/eclipse-kanto/aws-connector/config"
 	"github.com/eclipse-kanto/aws-connector/routing/bus"
@@ -37,6 +38,7 @@ func startRouter(
 	statusPub message.Publisher,
 	deviceHandlers []handlers.MessageHandler,
 	cloudHandlers []handlers.MessageHandler,
+	childThings *bus.ChildThings,
 	done chan bool,
 	logger logger.Logger,
 ) (*message.Router, error) {
@@ -65,16 +67,42 @@ func startRouter(
 	routing.SendGwParams(params, false, paramsPub, logger)
 
 	awsPub := connector.NewPublisher(awsClient, connector.QosAtLeastOnce, logger, nil)
-	awsSub := connector.NewSubscriber(awsClient, connector.QosAtMostOnce, false, logger, nil)
+	awsCommandsPub := bus.NewQosPublisher(awsPub, connector.Qos(settings.CommandResponsesQos))
+	var limiter *bus.RateLimiter
+	if settings.RateLimit > 0 {
+		limiter = bus.NewRateLimiter(awsPub, statusPub, &settings.RateLimitSettings, router.Logger())
+		awsPub = limiter.Publisher(handlers.PriorityLow)
+		awsCommandsPub = bus.NewQosPublisher(limiter.Publisher(handlers.PriorityHigh), connector.Qos(settings.CommandResponsesQos))
+	}
+	awsShadowSub := connector.NewSubscriber(awsClient, connector.Qos(settings.ShadowSubscriptionsQos), false, logger, nil)
+	awsCommandsSub := connector.NewSubscriber(awsClient, connector.Qos(settings.CommandsQos), false, logger, nil)
 	mosquittoSub := connector.NewSubscriber(cloudClient, connector.QosAtLeastOnce, false, router.Logger(), nil)
 	cloudPub := connector.NewPublisher(cloudClient, connector.QosAtLeastOnce, router.Logger(), nil)
 
 	reqCache := cache.NewTTLCache()
+	timeout := time.Duration(settings.CommandTimeout) * time.Millisecond
+	audit := bus.NewCommandAudit(&settings.AuditSettings, router.Logger())
+	var dedup *bus.CommandDedup
+	if settings.CommandDedupWindow > 0 {
+		window := time.Duration(settings.CommandDedupWindow) * time.Millisecond
+		dedup = bus.NewCommandDedup(window, settings.CommandDedupFile, settings.CommandDedupByPayload, awsCommandsPub, router.Logger())
+	}
+	tracker := bus.NewCommandTracker(reqCache, awsCommandsPub, statusPub, timeout, audit, dedup, router.Logger())
 
 	bus.MessageBus(router, awsPub, mosquittoSub, settings, deviceHandlers)
-	bus.MessageBus(router, cloudPub, awsSub, settings, cloudHandlers)
-	bus.CommandsReqBus(router, cloudPub, awsSub, reqCache, settings.DeviceID)
-	routing.CommandsResBus(router, awsPub, mosquittoSub, reqCache, "", settings.DeviceID, false)
+	bus.MessageBus(router, cloudPub, awsShadowSub, settings, cloudHandlers)
+	bus.CommandsReqBus(router, cloudPub, awsCommandsSub, tracker, settings.CommandPolicy, childThings, settings.DeviceID)
+	if settings.AwsCommands {
+		bus.AwsCommandsReqBus(router, cloudPub, awsCommandsSub, tracker, settings.CommandPolicy, childThings, settings.DeviceID)
+	}
+	if len(settings.CommandRoutes) > 0 {
+		bus.CommandRoutesBus(router, cloudPub, awsCommandsSub, tracker, settings.CommandPolicy, childThings, settings.DeviceID, settings.CommandRoutes)
+	}
+	bus.CommandsResBus(router, awsCommandsPub, mosquittoSub, tracker, settings.DeviceID)
+	if settings.ChildRegistration {
+		awsProvisioningSub := connector.NewSubscriber(awsClient, connector.QosAtLeastOnce, false, logger, nil)
+		bus.ChildRegistrationBus(router, awsPub, awsProvisioningSub, childThings)
+	}
 
 	go func() {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -84,7 +112,17 @@ func startRouter(
 			defer func() {
 				routing.SendStatus(routing.StatusConnectionClosed, statusPub, logger)
 
+				tracker.Close()
+				childThings.Close()
+				limiter.Close()
 				reqCache.Close()
+				audit.Close()
+				dedup.Close()
+				for _, handler := range deviceHandlers {
+					if closer, ok := handler.(handlers.Closer); ok {
+						closer.Close()
+					}
+				}
 
 				if cleanup != nil {
 					cleanup()
@@ -125,9 +163,16 @@ func startRouter(
 				router.Close()
 				return
 			}
+			childThings.StartRegistration()
 
 			<-ctx.Done()
 
+			for _, handler := range deviceHandlers {
+				if flusher, ok := handler.(handlers.Flusher); ok {
+					flusher.Flush()
+				}
+			}
+
 			awsClient.RemoveConnectionListener(errorsHandler)
 			awsClient.RemoveConnectionListener(connHandler)
 			cloudClient.RemoveConnectionListener(reconnectHandler)
@@ -151,7 +196,12 @@ func startRouter(
 }
 
 // MainLoop is the main loop of the application
-func MainLoop(settings *awscfg.CloudSettings, log logger.Logger, deviceHandlers []handlers.MessageHandler, cloudHandlers []handlers.MessageHandler) error {
+func MainLoop(settings *awscfg.CloudSettings,
+	log logger.Logger,
+	deviceHandlers []handlers.MessageHandler,
+	cloudHandlers []handlers.MessageHandler,
+	childThings *bus.ChildThings,
+) error {
 	localClient, err := config.CreateLocalConnection(&settings.LocalConnectionSettings, log)
 	if err != nil {
 		return errors.Wrap(err, "cannot create mosquitto connection")
@@ -165,7 +215,7 @@ func MainLoop(settings *awscfg.CloudSettings, log logger.Logger, deviceHandlers
 	defer statusPub.Close()
 
 	done := make(chan bool, 1)
-	awsRouter, err := startRouter(localClient, settings, statusPub, deviceHandlers, cloudHandlers, done, log)
+	awsRouter, err := startRouter(localClient, settings, statusPub, deviceHandlers, cloudHandlers, childThings, done, log)
 	if err != nil {
 		log.Error("Failed to create message bus", err, nil)
 	}
@@ -20,7 +20,9 @@ import (
 	"github.com/eclipse-kanto/aws-connector/cmd/aws-connector/app"
 	awscfg "github.com/eclipse-kanto/aws-connector/config"
 	"github.com/eclipse-kanto/aws-connector/flags"
+	"github.com/eclipse-kanto/aws-connector/routing/bus"
 	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers/live"
 	"github.com/eclipse-kanto/aws-connector/routing/message/handlers/passthrough"
 	"github.com/eclipse-kanto/aws-connector/routing/message/handlers/state"
 
@@ -75,6 +77,10 @@ func main() {
 		log.Fatal(errors.Wrap(err, "settings validation error"))
 	}
 
+	if err := settings.ReadCommandPolicy(); err != nil {
+		log.Fatal(errors.Wrap(err, "cannot read command policy"))
+	}
+
 	loggerOut, logger := logger.Setup("aws-connector", &settings.LogSettings)
 	defer loggerOut.Close()
 
@@ -85,12 +91,24 @@ func main() {
 	cloudHandlers := []handlers.MessageHandler{
 		shadowStateHandler,
 	}
+	var deviceOptions []passthrough.DeviceHandlerOption
+	if len(settings.LiveTopicTemplate) > 0 {
+		liveRequests := live.NewLiveRequests()
+		cloudHandlers = append(cloudHandlers, live.CreateDefaultLiveResponseHandler(liveRequests))
+		deviceOptions = append(deviceOptions, passthrough.WithLiveRequests(liveRequests))
+	}
+
+	var childThings *bus.ChildThings
+	if settings.KnownChildThings || settings.GatewayMode {
+		childThings = bus.NewChildThings(settings.DeviceID, &settings.GatewaySettings, logger)
+		deviceOptions = append(deviceOptions, passthrough.WithThingsObserver(childThings))
+	}
 
 	deviceHandlers := []handlers.MessageHandler{
-		passthrough.CreateDefaultDeviceHandler(shadowStateHandler.(passthrough.ShadowStateHolder)),
+		passthrough.CreateDefaultDeviceHandler(shadowStateHandler.(passthrough.ShadowStateHolder), deviceOptions...),
 	}
 
-	if err := app.MainLoop(settings, logger, deviceHandlers, cloudHandlers); err != nil {
+	if err := app.MainLoop(settings, logger, deviceHandlers, cloudHandlers, childThings); err != nil {
 		logger.Error("Init failure", err, nil)
 		loggerOut.Close()
 		os.Exit(1)
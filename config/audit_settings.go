@@ -0,0 +1,53 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Supported payload capture modes of the command audit log.
+const (
+	AuditPayloadNone = "none"
+	AuditPayloadHash = "hash"
+	AuditPayloadFull = "full"
+)
+
+// AuditSettings represents the audit log of the cloud-to-device commands and their responses.
+// The audit file size is in megabytes, the audit file count is the number of rotated files to be kept.
+type AuditSettings struct {
+	AuditFile      string `json:"auditFile"`
+	AuditFileSize  int    `json:"auditFileSize"`
+	AuditFileCount int    `json:"auditFileCount"`
+	AuditPayload   string `json:"auditPayload"`
+}
+
+// Validate validates the audit settings, empty audit file disables the audit log.
+func (settings *AuditSettings) Validate() error {
+	if len(settings.AuditFile) == 0 {
+		return nil
+	}
+	if settings.AuditFileSize <= 0 {
+		return errors.New("auditFileSize <= 0")
+	}
+	if settings.AuditFileCount <= 0 {
+		return errors.New("auditFileCount <= 0")
+	}
+	switch settings.AuditPayload {
+	case AuditPayloadNone, AuditPayloadHash, AuditPayloadFull:
+		return nil
+	default:
+		return errors.Errorf("unsupported auditPayload '%s', expected '%s', '%s' or '%s'",
+			settings.AuditPayload, AuditPayloadNone, AuditPayloadHash, AuditPayloadFull)
+	}
+}
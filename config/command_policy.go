@@ -0,0 +1,136 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCommandSenderHeader is the default Ditto header identifying the sender of the commands.
+const DefaultCommandSenderHeader = "ditto-originator"
+
+// CommandPolicy represents the local authorization policy of the commands sent to the device.
+// The rules are evaluated in order and the first matching rule decides, the default action
+// applies to the commands not matching any rule.
+type CommandPolicy struct {
+	Default      string              `json:"default"`
+	SenderHeader string              `json:"senderHeader"`
+	Rules        []CommandPolicyRule `json:"rules"`
+}
+
+// CommandPolicyRule represents an allow or deny rule of the commands with matching thing ID, feature ID,
+// message subject and sender header value regex filters, a rule without filters matches all commands.
+type CommandPolicyRule struct {
+	Action        string         `json:"action"`
+	Thing         string         `json:"thing"`
+	ThingRegexp   *regexp.Regexp `json:"-"`
+	Feature       string         `json:"feature"`
+	FeatureRegexp *regexp.Regexp `json:"-"`
+	Subject       string         `json:"subject"`
+	SubjectRegexp *regexp.Regexp `json:"-"`
+	Sender        string         `json:"sender"`
+	SenderRegexp  *regexp.Regexp `json:"-"`
+}
+
+// ReadCommandPolicy reads the command authorization policy file, if configured.
+func (settings *CloudSettings) ReadCommandPolicy() error {
+	if len(settings.CommandPolicyFile) == 0 {
+		return nil
+	}
+	policy, err := LoadCommandPolicy(settings.CommandPolicyFile)
+	if err != nil {
+		return err
+	}
+	settings.CommandPolicy = policy
+	return nil
+}
+
+// LoadCommandPolicy reads, compiles and validates the command authorization policy file.
+// The commands not matching any rule are denied by default.
+func LoadCommandPolicy(file string) (*CommandPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &CommandPolicy{Default: TopicFilterDeny, SenderHeader: DefaultCommandSenderHeader}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrap(err, "invalid command policy")
+	}
+	for i := range policy.Rules {
+		if err := policy.Rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return policy, policy.Validate()
+}
+
+// Allows returns true if the command with the provided thing ID, feature ID, subject and sender is allowed,
+// along with the deciding rule, which is nil if the default action applies.
+func (policy *CommandPolicy) Allows(thing, feature, subject, sender string) (bool, *CommandPolicyRule) {
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Matches(thing, feature, subject, sender) {
+			return rule.Action == TopicFilterAllow, rule
+		}
+	}
+	return policy.Default == TopicFilterAllow, nil
+}
+
+// Matches returns true if the command with the provided thing ID, feature ID, subject and sender matches all rule filters.
+func (rule *CommandPolicyRule) Matches(thing, feature, subject, sender string) bool {
+	return matchesOptional(rule.ThingRegexp, thing) &&
+		matchesOptional(rule.FeatureRegexp, feature) &&
+		matchesOptional(rule.SubjectRegexp, subject) &&
+		matchesOptional(rule.SenderRegexp, sender)
+}
+
+// compile prepares the regex filters of the rule.
+func (rule *CommandPolicyRule) compile() (err error) {
+	if rule.ThingRegexp, err = compileOptional(rule.Thing); err != nil {
+		return err
+	}
+	if rule.FeatureRegexp, err = compileOptional(rule.Feature); err != nil {
+		return err
+	}
+	if rule.SubjectRegexp, err = compileOptional(rule.Subject); err != nil {
+		return err
+	}
+	rule.SenderRegexp, err = compileOptional(rule.Sender)
+	return err
+}
+
+// Validate validates the command policy actions.
+func (policy *CommandPolicy) Validate() error {
+	if policy.Default != TopicFilterAllow && policy.Default != TopicFilterDeny {
+		return errors.Errorf("unsupported command policy default '%s', expected '%s' or '%s'",
+			policy.Default, TopicFilterAllow, TopicFilterDeny)
+	}
+	if len(policy.SenderHeader) == 0 {
+		return errors.New("command policy senderHeader is missing")
+	}
+	for _, rule := range policy.Rules {
+		if rule.Action != TopicFilterAllow && rule.Action != TopicFilterDeny {
+			return errors.Errorf("unsupported command policy rule action '%s', expected '%s' or '%s'",
+				rule.Action, TopicFilterAllow, TopicFilterDeny)
+		}
+	}
+	return nil
+}
+
+func matchesOptional(exp *regexp.Regexp, value string) bool {
+	return exp == nil || exp.MatchString(value)
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Placeholders supported by the command route templates.
+const (
+	PlaceholderCorrelationID = "correlationId"
+	PlaceholderStatus        = "status"
+	PlaceholderPayload       = "payload"
+)
+
+// DefaultCommandTimeout is the default timeout in milliseconds of the commands without Ditto timeout header.
+const DefaultCommandTimeout = 60000
+
+// MaxCommandTimeout is the exclusive upper limit of the Ditto timeout header of the commands.
+const MaxCommandTimeout = time.Hour
+
+// DefaultCommandDedupFile is the default file persisting the command dedup window.
+const DefaultCommandDedupFile = "state/command-dedup.json"
+
+var (
+	wildcardNameRegexp   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+	commandTimeoutRegexp = regexp.MustCompile(`^([0-9]+)(ms|s|m)?$`)
+	commandTimeoutUnits  = map[string]time.Duration{"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "": time.Second}
+)
+
+// CommandSettings represents the handling of the cloud-to-device commands.
+// The command timeout in milliseconds applies to the commands without Ditto timeout header.
+// The commands redelivered within the command dedup window in milliseconds are dropped.
+type CommandSettings struct {
+	AwsCommands           bool           `json:"awsCommands"`
+	CommandTimeout        int            `json:"commandTimeout"`
+	CommandRoutes         []CommandRoute `json:"commandRoutes"`
+	CommandPolicyFile     string         `json:"commandPolicyFile"`
+	CommandPolicy         *CommandPolicy `json:"-"`
+	CommandDedupWindow    int            `json:"commandDedupWindow"`
+	CommandDedupFile      string         `json:"commandDedupFile"`
+	CommandDedupByPayload bool           `json:"commandDedupByPayload"`
+}
+
+// CommandRoute represents the conversion of the commands received on an AWS IoT topic to Ditto live messages.
+// The topic levels in format {name} are named single-level wildcards, their values can be used in the
+// thingId, feature, subject, value and replyTopic templates.
+type CommandRoute struct {
+	Topic       string         `json:"topic"`
+	TopicRegexp *regexp.Regexp `json:"-"`
+	ThingID     string         `json:"thingId"`
+	Feature     string         `json:"feature"`
+	Subject     string         `json:"subject"`
+	Value       interface{}    `json:"value"`
+	Timeout     string         `json:"timeout"`
+	ReplyTopic  string         `json:"replyTopic"`
+	ReplyFormat string         `json:"replyFormat"`
+	wildcards   []string
+}
+
+// Filter returns the MQTT topic filter of the command route.
+func (route *CommandRoute) Filter() string {
+	return TopicTemplateFilter(route.Topic)
+}
+
+// Values returns the values of the named wildcards if the provided topic matches the command route.
+func (route *CommandRoute) Values(topic string) (map[string]string, bool) {
+	if route.TopicRegexp == nil {
+		return nil, false
+	}
+	match := route.TopicRegexp.FindStringSubmatch(topic)
+	if match == nil {
+		return nil, false
+	}
+	values := map[string]string{}
+	for i, name := range route.TopicRegexp.SubexpNames() {
+		if len(name) > 0 {
+			values[name] = match[i]
+		}
+	}
+	return values, true
+}
+
+// compile converts the topic pattern of the route to a regex with a named group per named wildcard.
+func (route *CommandRoute) compile() error {
+	route.wildcards = nil
+	levels := strings.Split(route.Topic, "/")
+	exprs := make([]string, len(levels))
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			exprs[i] = "[^/]+"
+		case level == "#" && i == len(levels)-1:
+			exprs[i] = ".*"
+		case PlaceholderRegexp.MatchString(level):
+			match := PlaceholderRegexp.FindStringSubmatch(level)
+			if match[0] != level || !wildcardNameRegexp.MatchString(match[1]) {
+				return errors.Errorf("invalid named wildcard '%s' of command route topic '%s'", level, route.Topic)
+			}
+			if contains(route.wildcards, match[1]) {
+				return errors.Errorf("duplicated named wildcard '%s' of command route topic '%s'", level, route.Topic)
+			}
+			route.wildcards = append(route.wildcards, match[1])
+			exprs[i] = fmt.Sprintf("(?P<%s>[^/]+)", match[1])
+		case strings.ContainsAny(level, "+#"):
+			return errors.Errorf("invalid wildcard '%s' of command route topic '%s'", level, route.Topic)
+		default:
+			exprs[i] = regexp.QuoteMeta(level)
+		}
+	}
+	exp, err := regexp.Compile("^" + strings.Join(exprs, "/") + "$")
+	if err != nil {
+		return err
+	}
+	route.TopicRegexp = exp
+	return nil
+}
+
+// Validate validates the command settings.
+func (settings *CommandSettings) Validate() error {
+	if settings.CommandTimeout < 0 {
+		return errors.New("commandTimeout must not be negative")
+	}
+	if settings.CommandDedupWindow < 0 {
+		return errors.New("commandDedupWindow must not be negative")
+	}
+	for _, route := range settings.CommandRoutes {
+		if err := route.validate(); err != nil {
+			return errors.Wrapf(err, "invalid command route '%s'", route.Topic)
+		}
+	}
+	return nil
+}
+
+func (route *CommandRoute) validate() error {
+	if len(route.Topic) == 0 {
+		return errors.New("topic is missing")
+	}
+	if len(route.Subject) == 0 {
+		return errors.New("subject is missing")
+	}
+	if len(route.Timeout) > 0 {
+		if _, err := ParseCommandTimeout(route.Timeout); err != nil {
+			return err
+		}
+	}
+
+	extra := append([]string{PlaceholderCorrelationID}, route.wildcards...)
+	for _, template := range []string{route.ThingID, route.Feature, route.Subject} {
+		if err := validateTemplate(template, extra...); err != nil {
+			return err
+		}
+	}
+	if err := validateValueTemplate(route.Value, append(extra, PlaceholderPayload)...); err != nil {
+		return errors.Wrap(err, "invalid value")
+	}
+
+	if strings.ContainsAny(route.ReplyTopic, "+#") {
+		return errors.New("wildcards are not allowed in replyTopic")
+	}
+	if err := validateTemplate(route.ReplyTopic, append(extra, PlaceholderStatus)...); err != nil {
+		return errors.Wrap(err, "invalid replyTopic")
+	}
+	if len(route.ReplyFormat) > 0 && route.ReplyFormat != OutputFormatEnvelope && route.ReplyFormat != OutputFormatValue {
+		return errors.Errorf("unsupported replyFormat '%s', expected '%s' or '%s'",
+			route.ReplyFormat, OutputFormatEnvelope, OutputFormatValue)
+	}
+	return nil
+}
+
+// ParseCommandTimeout parses the Ditto timeout header value, i.e. a number of milliseconds (ms),
+// seconds (s, the default unit) or minutes (m), less than MaxCommandTimeout.
+func ParseCommandTimeout(value string) (time.Duration, error) {
+	match := commandTimeoutRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, errors.Errorf("invalid timeout '%s'", value)
+	}
+	unit := commandTimeoutUnits[match[2]]
+	amount, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || amount >= int64(MaxCommandTimeout/unit) {
+		return 0, errors.Errorf("timeout '%s' out of range", value)
+	}
+	return time.Duration(amount) * unit, nil
+}
+
+// validateValueTemplate validates the placeholders of all string values of the provided payload template.
+func validateValueTemplate(value interface{}, extra ...string) error {
+	switch v := value.(type) {
+	case string:
+		return validateTemplate(v, extra...)
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := validateValueTemplate(item, extra...); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := validateValueTemplate(item, extra...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
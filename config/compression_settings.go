@@ -0,0 +1,52 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Supported payload compression algorithms and compressible message classes.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	MessageClassTelemetry = "telemetry"
+	MessageClassEvents    = "events"
+)
+
+// CompressionSettings represents the compression of the messages payload sent toward AWS IoT.
+type CompressionSettings struct {
+	Compression          string `json:"compression"`
+	CompressionClasses   string `json:"compressionClasses"`
+	CompressionThreshold int    `json:"compressionThreshold"`
+}
+
+// Validate validates the compression settings, empty compression algorithm disables the compression.
+func (settings *CompressionSettings) Validate() error {
+	if len(settings.Compression) > 0 && settings.Compression != CompressionGzip && settings.Compression != CompressionZstd {
+		return errors.Errorf("unsupported compression '%s', expected '%s' or '%s'", settings.Compression, CompressionGzip, CompressionZstd)
+	}
+	for _, class := range strings.Split(settings.CompressionClasses, ",") {
+		class = strings.TrimSpace(class)
+		if len(class) > 0 && class != MessageClassTelemetry && class != MessageClassEvents {
+			return errors.Errorf("unsupported compression class '%s', expected '%s' or '%s'", class, MessageClassTelemetry, MessageClassEvents)
+		}
+	}
+	if settings.CompressionThreshold < 0 {
+		return errors.New("compressionThreshold < 0")
+	}
+	return nil
+}
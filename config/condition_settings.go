@@ -0,0 +1,87 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/pkg/errors"
+)
+
+// MessageClassShadow is the class of the device shadow updates.
+const MessageClassShadow = "shadow"
+
+// RouteConditionSettings represents the conditions of forwarding messages toward AWS IoT.
+type RouteConditionSettings struct {
+	RouteConditions []RouteCondition `json:"routeConditions"`
+}
+
+// RouteCondition represents an expression which must evaluate to true for the messages of its class to be forwarded.
+type RouteCondition struct {
+	Name      string      `json:"name"`
+	Class     string      `json:"class"`
+	Condition string      `json:"condition"`
+	Program   *vm.Program `json:"-"`
+}
+
+// ConditionEnv represents the Ditto message data available to the route condition expressions.
+type ConditionEnv struct {
+	Class      string                 `expr:"class"`
+	Topic      string                 `expr:"topic"`
+	ThingID    string                 `expr:"thingId"`
+	Namespace  string                 `expr:"namespace"`
+	EntityName string                 `expr:"entityName"`
+	Channel    string                 `expr:"channel"`
+	Criterion  string                 `expr:"criterion"`
+	Action     string                 `expr:"action"`
+	Subject    string                 `expr:"subject"`
+	Feature    string                 `expr:"feature"`
+	Path       string                 `expr:"path"`
+	Headers    map[string]interface{} `expr:"headers"`
+	Value      interface{}            `expr:"value"`
+}
+
+// Matches returns true if the condition applies to the provided message class, a condition without class applies to all messages.
+func (rule *RouteCondition) Matches(class string) bool {
+	return len(rule.Class) == 0 || rule.Class == class
+}
+
+// Evaluate evaluates the compiled condition against the provided message data.
+func (rule *RouteCondition) Evaluate(env *ConditionEnv) (bool, error) {
+	result, err := expr.Run(rule.Program, env)
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// compile compiles the condition expression.
+func (rule *RouteCondition) compile() (err error) {
+	rule.Program, err = expr.Compile(rule.Condition, expr.Env(ConditionEnv{}), expr.AsBool())
+	return errors.Wrapf(err, "invalid route condition '%s'", rule.Condition)
+}
+
+// Validate validates the route conditions.
+func (settings *RouteConditionSettings) Validate() error {
+	for _, rule := range settings.RouteConditions {
+		if len(rule.Condition) == 0 {
+			return errors.Errorf("route condition '%s' is missing its expression", rule.Name)
+		}
+		if len(rule.Class) > 0 && rule.Class != MessageClassTelemetry &&
+			rule.Class != MessageClassEvents && rule.Class != MessageClassShadow {
+			return errors.Errorf("unsupported route condition class '%s', expected '%s', '%s' or '%s'",
+				rule.Class, MessageClassTelemetry, MessageClassEvents, MessageClassShadow)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// DeadbandSettings represents the suppression of insignificant property changes.
+type DeadbandSettings struct {
+	Deadbands []DeadbandRule `json:"deadbands"`
+}
+
+// DeadbandRule represents the significant change of the property values with matching path.
+// The path is relative to the thing, e.g. /features/climate/properties/temperature.
+type DeadbandRule struct {
+	Path        string         `json:"path"`
+	PathRegexp  *regexp.Regexp `json:"-"`
+	Absolute    float64        `json:"absolute"`
+	Percent     float64        `json:"percent"`
+	MinInterval int            `json:"minInterval"`
+	MaxInterval int            `json:"maxInterval"`
+}
+
+// compile prepares the regex filter of the rule.
+func (rule *DeadbandRule) compile() (err error) {
+	rule.PathRegexp, err = regexp.Compile(rule.Path)
+	return err
+}
+
+// Validate validates the deadband rules.
+func (settings *DeadbandSettings) Validate() error {
+	for _, rule := range settings.Deadbands {
+		if len(rule.Path) == 0 {
+			return errors.New("deadband path is missing")
+		}
+		if rule.Absolute < 0 {
+			return errors.Errorf("deadband absolute < 0 for path '%s'", rule.Path)
+		}
+		if rule.Percent < 0 {
+			return errors.Errorf("deadband percent < 0 for path '%s'", rule.Path)
+		}
+		if rule.MinInterval < 0 {
+			return errors.Errorf("deadband minInterval < 0 for path '%s'", rule.Path)
+		}
+		if rule.MaxInterval < 0 {
+			return errors.Errorf("deadband maxInterval < 0 for path '%s'", rule.Path)
+		}
+		if rule.MaxInterval > 0 && rule.MaxInterval < rule.MinInterval {
+			return errors.Errorf("deadband maxInterval < minInterval for path '%s'", rule.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Modes of the scoped payload filters.
+const (
+	PayloadFilterExclude = "exclude"
+	PayloadFilterInclude = "include"
+)
+
+// Actions of the topic filter rules.
+const (
+	TopicFilterAllow = "allow"
+	TopicFilterDeny  = "deny"
+)
+
+// TopicFilterRule represents an allow or deny rule for the messages with matching Ditto topic.
+type TopicFilterRule struct {
+	Action      string         `json:"action"`
+	Topic       string         `json:"topic"`
+	TopicRegexp *regexp.Regexp `json:"-"`
+}
+
+// Matches returns true if the rule matches the provided Ditto topic.
+func (rule *TopicFilterRule) Matches(topic string) bool {
+	return rule.TopicRegexp.MatchString(topic)
+}
+
+// compile prepares the regex filter of the rule.
+func (rule *TopicFilterRule) compile() (err error) {
+	rule.TopicRegexp, err = regexp.Compile(rule.Topic)
+	return err
+}
+
+// ScopedPayloadFilter represents payload filters applied to the things and features with matching IDs only.
+// In exclude mode the matching JSON paths are removed, in include mode all other JSON paths in scope are removed.
+type ScopedPayloadFilter struct {
+	Thing         string             `json:"thing"`
+	ThingRegexp   *regexp.Regexp     `json:"-"`
+	Feature       string             `json:"feature"`
+	FeatureRegexp *regexp.Regexp     `json:"-"`
+	Mode          string             `json:"mode"`
+	Paths         PayloadFiltersType `json:"paths"`
+	PathsRegexp   []*regexp.Regexp   `json:"-"`
+}
+
+// MatchesThing returns true if the filter applies to the provided thing ID.
+func (filter *ScopedPayloadFilter) MatchesThing(thingID string) bool {
+	return filter.ThingRegexp == nil || filter.ThingRegexp.MatchString(thingID)
+}
+
+// Excludes returns true if the JSON path of the provided feature, empty if outside of the features, should be removed.
+func (filter *ScopedPayloadFilter) Excludes(feature, path string) bool {
+	if filter.FeatureRegexp != nil && (len(feature) == 0 || !filter.FeatureRegexp.MatchString(feature)) {
+		return false
+	}
+
+	matched := false
+	for _, exp := range filter.PathsRegexp {
+		if exp.MatchString(path) {
+			matched = true
+			break
+		}
+	}
+	if filter.Mode == PayloadFilterInclude {
+		return !matched
+	}
+	return matched
+}
+
+// compile prepares the regex filters of the scoped payload filter.
+func (filter *ScopedPayloadFilter) compile() (err error) {
+	if filter.ThingRegexp, err = compileOptional(filter.Thing); err != nil {
+		return err
+	}
+	if filter.FeatureRegexp, err = compileOptional(filter.Feature); err != nil {
+		return err
+	}
+	filter.PathsRegexp = nil
+	for _, path := range filter.Paths {
+		exp, err := compilePayloadFilter(path)
+		if err != nil {
+			return err
+		}
+		filter.PathsRegexp = append(filter.PathsRegexp, exp)
+	}
+	return nil
+}
+
+// Validate validates the message filters.
+func (settings *MessageFilterSettings) Validate() error {
+	for _, filter := range settings.ScopedPayloadFilters {
+		if len(filter.Paths) == 0 {
+			return errors.New("scoped payload filter paths are missing")
+		}
+		if len(filter.Mode) > 0 && filter.Mode != PayloadFilterExclude && filter.Mode != PayloadFilterInclude {
+			return errors.Errorf("unsupported scoped payload filter mode '%s', expected '%s' or '%s'",
+				filter.Mode, PayloadFilterExclude, PayloadFilterInclude)
+		}
+	}
+	for _, rule := range settings.TopicFilters {
+		if len(rule.Topic) == 0 {
+			return errors.New("topic filter pattern is missing")
+		}
+		if rule.Action != TopicFilterAllow && rule.Action != TopicFilterDeny {
+			return errors.Errorf("unsupported topic filter action '%s', expected '%s' or '%s'",
+				rule.Action, TopicFilterAllow, TopicFilterDeny)
+		}
+	}
+	return nil
+}
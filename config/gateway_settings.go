@@ -0,0 +1,109 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultChildThingsFile is the default file persisting the registry of the child things.
+const DefaultChildThingsFile = "state/child-things.json"
+
+// DefaultChildRegistrationsFile is the default file persisting the AWS IoT thing names of the registered child things.
+const DefaultChildRegistrationsFile = "state/child-registrations.json"
+
+// DefaultChildRegistrationTimeout is the default time in milliseconds to wait for a child thing registration response.
+const DefaultChildRegistrationTimeout = 30000
+
+// DefaultChildThingNameTemplate is the default AWS IoT thing name template of the child things in gateway mode.
+const DefaultChildThingNameTemplate = "{thingId}"
+
+// GatewaySettings represents the handling of the child things of the device.
+// The child things are registered on their creation by the local applications, the commands are forwarded
+// only to the registered child things if known child things is enabled. In gateway mode each child thing
+// is represented by its own AWS IoT thing, named by the child thing name template. If child registration is
+// enabled, the AWS IoT things of the new child things are registered through the child provisioning template.
+type GatewaySettings struct {
+	KnownChildThings          bool   `json:"knownChildThings"`
+	ChildThingsFile           string `json:"childThingsFile"`
+	GatewayMode               bool   `json:"gatewayMode"`
+	ChildThingNameTemplate    string `json:"childThingNameTemplate"`
+	ChildRegistration         bool   `json:"childRegistration"`
+	ChildProvisioningTemplate string `json:"childProvisioningTemplate"`
+	ChildRegistrationTimeout  int    `json:"childRegistrationTimeout"`
+	ChildRegistrationsFile    string `json:"childRegistrationsFile"`
+}
+
+// ThingName returns the AWS IoT thing name of the Ditto thing with the provided ID. The device itself and,
+// if the gateway mode is disabled, its child things are represented by the AWS IoT thing of the device.
+func (settings *GatewaySettings) ThingName(deviceID, thingID string) string {
+	if !settings.GatewayMode || !strings.HasPrefix(thingID, deviceID+":") {
+		return deviceID
+	}
+	namespace, entityName := thingID, ""
+	if i := strings.Index(thingID, ":"); i >= 0 {
+		namespace, entityName = thingID[:i], thingID[i+1:]
+	}
+	return ExpandTemplate(settings.ChildThingNameTemplate, map[string]string{
+		PlaceholderDeviceID:   deviceID,
+		PlaceholderThingID:    thingID,
+		PlaceholderNamespace:  namespace,
+		PlaceholderEntityName: entityName,
+		PlaceholderChildID:    thingID[len(deviceID)+1:],
+	})
+}
+
+// Validate validates the gateway settings.
+func (settings *GatewaySettings) Validate() error {
+	if !settings.GatewayMode {
+		if settings.ChildRegistration {
+			return errors.New("childRegistration requires gatewayMode")
+		}
+		return nil
+	}
+	if err := settings.validateRegistration(); err != nil {
+		return err
+	}
+	if len(settings.ChildThingNameTemplate) == 0 {
+		return errors.New("childThingNameTemplate is missing")
+	}
+	if strings.ContainsAny(settings.ChildThingNameTemplate, "/+#") {
+		return errors.New("invalid childThingNameTemplate: topic separators and wildcards are not allowed")
+	}
+	for _, match := range PlaceholderRegexp.FindAllStringSubmatch(settings.ChildThingNameTemplate, -1) {
+		switch match[1] {
+		case PlaceholderDeviceID, PlaceholderThingID, PlaceholderNamespace, PlaceholderEntityName, PlaceholderChildID:
+		default:
+			return errors.Errorf("invalid childThingNameTemplate: unknown placeholder '%s'", match[0])
+		}
+	}
+	return nil
+}
+
+func (settings *GatewaySettings) validateRegistration() error {
+	if !settings.ChildRegistration {
+		return nil
+	}
+	if len(settings.ChildProvisioningTemplate) == 0 {
+		return errors.New("childProvisioningTemplate is missing")
+	}
+	if strings.ContainsAny(settings.ChildProvisioningTemplate, "/+#") {
+		return errors.New("invalid childProvisioningTemplate: topic separators and wildcards are not allowed")
+	}
+	if settings.ChildRegistrationTimeout <= 0 {
+		return errors.New("childRegistrationTimeout must be positive")
+	}
+	return nil
+}
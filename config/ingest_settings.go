@@ -0,0 +1,89 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var ruleNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
+// BasicIngestSettings represents the publishing of messages to AWS IoT Basic Ingest topics.
+type BasicIngestSettings struct {
+	BasicIngestRules []BasicIngestRule `json:"basicIngestRules"`
+}
+
+// BasicIngestRule represents an AWS IoT rule that receives the matching messages via its Basic Ingest topic.
+// All provided regex filters must match, a rule without filters matches all messages of its class.
+type BasicIngestRule struct {
+	RuleName      string         `json:"ruleName"`
+	Class         string         `json:"class"`
+	Feature       string         `json:"feature"`
+	FeatureRegexp *regexp.Regexp `json:"-"`
+	Topic         string         `json:"topic"`
+	TopicRegexp   *regexp.Regexp `json:"-"`
+	Subject       string         `json:"subject"`
+	SubjectRegexp *regexp.Regexp `json:"-"`
+}
+
+// Matches returns true if the rule matches the provided message class, Ditto topic, feature ID and message subject.
+func (rule *BasicIngestRule) Matches(class, topic, feature, subject string) bool {
+	if len(rule.Class) > 0 && rule.Class != class {
+		return false
+	}
+	if rule.TopicRegexp != nil && !rule.TopicRegexp.MatchString(topic) {
+		return false
+	}
+	if rule.FeatureRegexp != nil && !rule.FeatureRegexp.MatchString(feature) {
+		return false
+	}
+	if rule.SubjectRegexp != nil && !rule.SubjectRegexp.MatchString(subject) {
+		return false
+	}
+	return true
+}
+
+// compile prepares the regex filters of the rule.
+func (rule *BasicIngestRule) compile() (err error) {
+	if rule.FeatureRegexp, err = compileOptional(rule.Feature); err != nil {
+		return err
+	}
+	if rule.TopicRegexp, err = compileOptional(rule.Topic); err != nil {
+		return err
+	}
+	rule.SubjectRegexp, err = compileOptional(rule.Subject)
+	return err
+}
+
+// Validate validates the Basic Ingest rules.
+func (settings *BasicIngestSettings) Validate() error {
+	for _, rule := range settings.BasicIngestRules {
+		if !ruleNameRegexp.MatchString(rule.RuleName) {
+			return errors.Errorf("invalid basic ingest rule name '%s'", rule.RuleName)
+		}
+		if len(rule.Class) > 0 && rule.Class != MessageClassTelemetry && rule.Class != MessageClassEvents {
+			return errors.Errorf("unsupported basic ingest rule class '%s', expected '%s' or '%s'",
+				rule.Class, MessageClassTelemetry, MessageClassEvents)
+		}
+	}
+	return nil
+}
+
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LiveSettings represents the forwarding of the Ditto live messages and events to AWS IoT topics.
+type LiveSettings struct {
+	LiveTopicTemplate string `json:"liveTopicTemplate"`
+}
+
+// Validate validates the live settings, empty template disables the forwarding.
+func (settings *LiveSettings) Validate() error {
+	if len(settings.LiveTopicTemplate) == 0 {
+		return nil
+	}
+	if strings.ContainsAny(settings.LiveTopicTemplate, "+#") {
+		return errors.New("invalid liveTopicTemplate: wildcards are not allowed")
+	}
+	return errors.Wrap(validateTemplate(settings.LiveTopicTemplate), "invalid liveTopicTemplate")
+}
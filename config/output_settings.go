@@ -0,0 +1,64 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Output formats of the telemetry and event messages sent toward AWS IoT.
+const (
+	OutputFormatEnvelope = "envelope"
+	OutputFormatValue    = "value"
+)
+
+// OutputFormatSettings represents the payload formats of the telemetry and event messages per Ditto topic.
+type OutputFormatSettings struct {
+	OutputFormats []OutputFormatRule `json:"outputFormats"`
+}
+
+// OutputFormatRule represents the payload format of the messages with matching Ditto topic.
+// The value format emits only the envelope value, optionally with the envelope path, timestamp
+// and the selected headers as top level fields.
+type OutputFormatRule struct {
+	Topic       string         `json:"topic"`
+	TopicRegexp *regexp.Regexp `json:"-"`
+	Format      string         `json:"format"`
+	Path        bool           `json:"path"`
+	Timestamp   bool           `json:"timestamp"`
+	Headers     []string       `json:"headers"`
+}
+
+// Matches returns true if the rule matches the provided Ditto topic, a rule without topic filter matches all messages.
+func (rule *OutputFormatRule) Matches(topic string) bool {
+	return rule.TopicRegexp == nil || rule.TopicRegexp.MatchString(topic)
+}
+
+// compile prepares the regex filter of the rule.
+func (rule *OutputFormatRule) compile() (err error) {
+	rule.TopicRegexp, err = compileOptional(rule.Topic)
+	return err
+}
+
+// Validate validates the output format rules.
+func (settings *OutputFormatSettings) Validate() error {
+	for _, rule := range settings.OutputFormats {
+		if rule.Format != OutputFormatEnvelope && rule.Format != OutputFormatValue {
+			return errors.Errorf("unsupported output format '%s', expected '%s' or '%s'",
+				rule.Format, OutputFormatEnvelope, OutputFormatValue)
+		}
+	}
+	return nil
+}
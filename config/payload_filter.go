@@ -0,0 +1,185 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Prefixes selecting the syntax of a payload filter, filters without prefix are regular expressions.
+const (
+	PayloadFilterRegexPrefix       = "regex:"
+	PayloadFilterJSONPointerPrefix = "jsonpointer:"
+	PayloadFilterJSONPathPrefix    = "jsonpath:"
+)
+
+// Used to match any key or index of a single JSON path level.
+const anyLevel = "[^/]+"
+
+// compilePayloadFilter compiles the payload filter to a regular expression matching the slash separated JSON paths,
+// e.g. /features/meter/properties/values/0. JSON Pointer and JSONPath filters match all JSON paths below the selected values.
+func compilePayloadFilter(filter string) (*regexp.Regexp, error) {
+	switch {
+	case strings.HasPrefix(filter, PayloadFilterJSONPointerPrefix):
+		expr, err := jsonPointerExpr(strings.TrimPrefix(filter, PayloadFilterJSONPointerPrefix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON Pointer payload filter '%s'", filter)
+		}
+		return regexp.Compile(expr)
+
+	case strings.HasPrefix(filter, PayloadFilterJSONPathPrefix):
+		expr, err := jsonPathExpr(strings.TrimPrefix(filter, PayloadFilterJSONPathPrefix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JSONPath payload filter '%s'", filter)
+		}
+		return regexp.Compile(expr)
+
+	default:
+		return regexp.Compile(strings.TrimPrefix(filter, PayloadFilterRegexPrefix))
+	}
+}
+
+// jsonPointerExpr converts the RFC 6901 JSON Pointer to a regular expression.
+func jsonPointerExpr(pointer string) (string, error) {
+	if len(pointer) > 0 && !strings.HasPrefix(pointer, "/") {
+		return "", errors.New("JSON Pointer must start with '/'")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if len(pointer) > 0 {
+		for _, token := range strings.Split(pointer[1:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			expr.WriteString("/" + regexp.QuoteMeta(token))
+		}
+	}
+	expr.WriteString("(/.*)?$")
+	return expr.String(), nil
+}
+
+// jsonPathExpr converts the JSONPath to a regular expression.
+// Supported are child names, wildcards, recursive descent, array indices, unions and bounded slices.
+func jsonPathExpr(path string) (string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return "", errors.New("JSONPath must start with '$'")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			expr.WriteString("(/" + anyLevel + ")*")
+			rest = rest[2:]
+			if len(rest) == 0 {
+				return "", errors.New("missing selector after '..'")
+			}
+			if rest[0] != '[' {
+				var name string
+				name, rest = readName(rest)
+				if len(name) == 0 {
+					return "", errors.New("missing name after '..'")
+				}
+				expr.WriteString("/" + nameExpr(name))
+			}
+
+		case rest[0] == '.':
+			var name string
+			name, rest = readName(rest[1:])
+			if len(name) == 0 {
+				return "", errors.New("missing name after '.'")
+			}
+			expr.WriteString("/" + nameExpr(name))
+
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return "", errors.New("missing ']'")
+			}
+			selector, err := selectorExpr(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return "", err
+			}
+			expr.WriteString("/" + selector)
+			rest = rest[end+1:]
+
+		default:
+			return "", errors.Errorf("unexpected '%s'", rest)
+		}
+	}
+	expr.WriteString("(/.*)?$")
+	return expr.String(), nil
+}
+
+// readName returns the dot notation name and the remaining part of the JSONPath.
+func readName(path string) (string, string) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		return path, ""
+	}
+	return path[:end], path[end:]
+}
+
+func nameExpr(name string) string {
+	if name == "*" {
+		return anyLevel
+	}
+	return regexp.QuoteMeta(name)
+}
+
+// selectorExpr converts the bracket notation selector, i.e. wildcard, slice or union of names and indices.
+func selectorExpr(selector string) (string, error) {
+	if selector == "*" {
+		return anyLevel, nil
+	}
+
+	if strings.Contains(selector, ":") {
+		bounds := strings.Split(selector, ":")
+		if len(bounds) != 2 {
+			return "", errors.Errorf("unsupported slice '%s'", selector)
+		}
+		start, end := 0, 0
+		var err error
+		if len(strings.TrimSpace(bounds[0])) > 0 {
+			if start, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil || start < 0 {
+				return "", errors.Errorf("invalid slice start '%s'", selector)
+			}
+		}
+		if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || end <= start {
+			return "", errors.Errorf("invalid slice end '%s'", selector)
+		}
+		indices := make([]string, 0, end-start)
+		for i := start; i < end; i++ {
+			indices = append(indices, strconv.Itoa(i))
+		}
+		return "(" + strings.Join(indices, "|") + ")", nil
+	}
+
+	items := []string{}
+	for _, item := range strings.Split(selector, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 1 && (item[0] == '\'' || item[0] == '"') && item[len(item)-1] == item[0] {
+			items = append(items, regexp.QuoteMeta(item[1:len(item)-1]))
+		} else if index, err := strconv.Atoi(item); err == nil && index >= 0 {
+			items = append(items, item)
+		} else {
+			return "", errors.Errorf("unsupported selector '%s'", item)
+		}
+	}
+	return "(" + strings.Join(items, "|") + ")", nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ThingGroupsAttribute is the Ditto attribute mapped to the AWS IoT thing groups membership of the thing.
+const ThingGroupsAttribute = "thingGroups"
+
+var registryAttributeRegexp = regexp.MustCompile("^[a-zA-Z0-9_.,@:#-]+$")
+
+// RegistrySettings represents the sync of the selected Ditto thing attributes to the AWS IoT registry attributes.
+// The thingGroups attribute is mapped to the thing groups membership of the AWS IoT thing. The changes are sent
+// to the Basic Ingest topics of the registry rule.
+type RegistrySettings struct {
+	RegistryAttributes AttributeNamesType `json:"registryAttributes"`
+	RegistryRule       string             `json:"registryRule"`
+}
+
+// AttributeNamesType represents Ditto attribute names.
+type AttributeNamesType []string
+
+func (v *AttributeNamesType) String() string {
+	if len(*v) > 0 {
+		return "['" + strings.Join(*v, "', '") + "']"
+	}
+	return "[]"
+}
+
+// Set additional attribute name.
+func (v *AttributeNamesType) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+// Get attribute names.
+func (v *AttributeNamesType) Get() interface{} {
+	return v
+}
+
+// Validate validates the registry settings.
+func (settings *RegistrySettings) Validate() error {
+	if len(settings.RegistryAttributes) == 0 {
+		return nil
+	}
+	for _, name := range settings.RegistryAttributes {
+		if !registryAttributeRegexp.MatchString(name) {
+			return errors.Errorf("invalid registry attribute '%s'", name)
+		}
+	}
+	if len(settings.RegistryRule) == 0 {
+		return errors.New("registryRule is required")
+	}
+	if !ruleNameRegexp.MatchString(settings.RegistryRule) {
+		return errors.Errorf("invalid registry rule name '%s'", settings.RegistryRule)
+	}
+	return nil
+}
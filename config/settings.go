@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"github.com/eclipse-kanto/suite-connector/config"
+	"github.com/eclipse-kanto/suite-connector/connector"
 	"github.com/eclipse-kanto/suite-connector/logger"
 	suiteUtil "github.com/eclipse-kanto/suite-connector/util"
 	"github.com/pkg/errors"
@@ -31,14 +32,55 @@ type CloudSettings struct {
 	config.HubConnectionSettings
 	logger.LogSettings
 	MessageFilterSettings
+	QosSettings
+	RateLimitSettings
+	TelemetryBatchSettings
+	CompressionSettings
+	BasicIngestSettings
+	TopicTemplateSettings
+	OutputFormatSettings
+	SiteWiseSettings
+	TransformSettings
+	RouteConditionSettings
+	DeadbandSettings
+	LiveSettings
+	CommandSettings
+	AuditSettings
+	GatewaySettings
+	RegistrySettings
 }
 
 // MessageFilterSettings represents all configurable filters.
 type MessageFilterSettings struct {
-	TopicFilter          string             `json:"topicFilter"`
-	TopicFilterRegexp    *regexp.Regexp     `json:"-"`
-	PayloadFilters       PayloadFiltersType `json:"payloadFilters"`
-	PayloadFiltersRegexp []*regexp.Regexp   `json:"-"`
+	TopicFilter          string                `json:"topicFilter"`
+	TopicFilterRegexp    *regexp.Regexp        `json:"-"`
+	PayloadFilters       PayloadFiltersType    `json:"payloadFilters"`
+	PayloadFiltersRegexp []*regexp.Regexp      `json:"-"`
+	TopicFilters         []TopicFilterRule     `json:"topicFilters"`
+	ScopedPayloadFilters []ScopedPayloadFilter `json:"scopedPayloadFilters"`
+}
+
+// QosSettings represents the quality of service levels used per message class toward AWS IoT.
+type QosSettings struct {
+	TelemetryQos           int `json:"telemetryQos"`
+	EventsQos              int `json:"eventsQos"`
+	ShadowUpdatesQos       int `json:"shadowUpdatesQos"`
+	ShadowSubscriptionsQos int `json:"shadowSubscriptionsQos"`
+	CommandsQos            int `json:"commandsQos"`
+	CommandResponsesQos    int `json:"commandResponsesQos"`
+}
+
+// RateLimitSettings represents the client-side rate limiting of the messages published toward AWS IoT.
+type RateLimitSettings struct {
+	RateLimit         float64 `json:"rateLimit"`
+	RateLimitBurst    int     `json:"rateLimitBurst"`
+	RateLimitMaxDelay int     `json:"rateLimitMaxDelay"`
+}
+
+// TelemetryBatchSettings represents the grouping of telemetry messages into a single AWS IoT message.
+type TelemetryBatchSettings struct {
+	TelemetryBatchWindow   int `json:"telemetryBatchWindow"`
+	TelemetryBatchMaxBytes int `json:"telemetryBatchMaxBytes"`
 }
 
 // PayloadFiltersType represents payload filters.
@@ -75,6 +117,27 @@ func DefaultSettings() *CloudSettings {
 	defSettings.TenantID = "default-tenant-id"
 	defSettings.LogFile = "logs/aws-connector.log"
 	defSettings.TopicFilter = ""
+	defSettings.TelemetryQos = int(connector.QosAtLeastOnce)
+	defSettings.EventsQos = int(connector.QosAtLeastOnce)
+	defSettings.ShadowUpdatesQos = int(connector.QosAtLeastOnce)
+	defSettings.ShadowSubscriptionsQos = int(connector.QosAtMostOnce)
+	defSettings.CommandsQos = int(connector.QosAtMostOnce)
+	defSettings.CommandResponsesQos = int(connector.QosAtLeastOnce)
+	defSettings.RateLimitBurst = 100
+	defSettings.RateLimitMaxDelay = 5000
+	defSettings.CompressionClasses = MessageClassTelemetry
+	defSettings.CompressionThreshold = 1024
+	defSettings.SiteWiseAliasTemplate = DefaultSiteWiseAliasTemplate
+	defSettings.CommandTimeout = DefaultCommandTimeout
+	defSettings.CommandDedupFile = DefaultCommandDedupFile
+	defSettings.CommandDedupByPayload = true
+	defSettings.AuditFileSize = 2
+	defSettings.AuditFileCount = 5
+	defSettings.AuditPayload = AuditPayloadNone
+	defSettings.ChildThingsFile = DefaultChildThingsFile
+	defSettings.ChildThingNameTemplate = DefaultChildThingNameTemplate
+	defSettings.ChildRegistrationTimeout = DefaultChildRegistrationTimeout
+	defSettings.ChildRegistrationsFile = DefaultChildRegistrationsFile
 	return defSettings
 }
 
@@ -109,12 +172,52 @@ func (settings *CloudSettings) CompileFilters() error {
 		}
 	}
 	for _, v := range settings.PayloadFilters {
-		if exp, err := regexp.Compile(v); err == nil {
+		if exp, err := compilePayloadFilter(v); err == nil {
 			settings.PayloadFiltersRegexp = append(settings.PayloadFiltersRegexp, exp)
 		} else {
 			return err
 		}
 	}
+	for i := range settings.ScopedPayloadFilters {
+		if err := settings.ScopedPayloadFilters[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.TopicFilters {
+		if err := settings.TopicFilters[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.BasicIngestRules {
+		if err := settings.BasicIngestRules[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.Transformations {
+		if err := settings.Transformations[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.RouteConditions {
+		if err := settings.RouteConditions[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.Deadbands {
+		if err := settings.Deadbands[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.OutputFormats {
+		if err := settings.OutputFormats[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range settings.CommandRoutes {
+		if err := settings.CommandRoutes[i].compile(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -135,5 +238,116 @@ func (settings *CloudSettings) Validate() error {
 	if len(settings.CACert) > 0 && !suiteUtil.FileExists(settings.CACert) {
 		return errors.New("failed to read CA certificates file")
 	}
+
+	if err := settings.MessageFilterSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.QosSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.RateLimitSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.TelemetryBatchSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.CompressionSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.BasicIngestSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.TopicTemplateSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.OutputFormatSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.SiteWiseSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.TransformSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.RouteConditionSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.DeadbandSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.LiveSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.CommandSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.AuditSettings.Validate(); err != nil {
+		return err
+	}
+
+	if err := settings.GatewaySettings.Validate(); err != nil {
+		return err
+	}
+
+	return settings.RegistrySettings.Validate()
+}
+
+// Validate validates the telemetry batch settings, zero time window disables the batching.
+func (settings *TelemetryBatchSettings) Validate() error {
+	if settings.TelemetryBatchWindow < 0 {
+		return errors.New("telemetryBatchWindow < 0")
+	}
+	if settings.TelemetryBatchMaxBytes < 0 {
+		return errors.New("telemetryBatchMaxBytes < 0")
+	}
+	return nil
+}
+
+// Validate validates the rate limit settings, zero rate limit disables the rate limiting.
+func (settings *RateLimitSettings) Validate() error {
+	if settings.RateLimit < 0 {
+		return errors.New("rateLimit < 0")
+	}
+	if settings.RateLimit > 0 && settings.RateLimitBurst <= 0 {
+		return errors.New("rateLimitBurst <= 0")
+	}
+	if settings.RateLimitMaxDelay < 0 {
+		return errors.New("rateLimitMaxDelay < 0")
+	}
+	return nil
+}
+
+// Validate validates the quality of service levels, AWS IoT supports only QoS 0 and 1.
+func (settings *QosSettings) Validate() error {
+	levels := []struct {
+		name string
+		qos  int
+	}{
+		{"telemetryQos", settings.TelemetryQos},
+		{"eventsQos", settings.EventsQos},
+		{"shadowUpdatesQos", settings.ShadowUpdatesQos},
+		{"shadowSubscriptionsQos", settings.ShadowSubscriptionsQos},
+		{"commandsQos", settings.CommandsQos},
+		{"commandResponsesQos", settings.CommandResponsesQos},
+	}
+	for _, level := range levels {
+		if level.qos != int(connector.QosAtMostOnce) && level.qos != int(connector.QosAtLeastOnce) {
+			return errors.Errorf("unsupported %s value %d, expected 0 or 1", level.name, level.qos)
+		}
+	}
 	return nil
 }
@@ -58,6 +58,57 @@ func TestPayloadFilterInvalid(t *testing.T) {
 	require.Empty(t, settings.PayloadFiltersRegexp)
 }
 
+func TestPayloadFilterSyntax(t *testing.T) {
+	tests := []struct {
+		filter  string
+		matches []string
+		skips   []string
+	}{
+		{"regex:/status$", []string{"/features/x/properties/status"}, []string{"/features/x/properties/code"}},
+		{"jsonpointer:/features/x/properties", []string{"/features/x/properties/a", "/features/x/properties"}, []string{"/features/x/propertiesA"}},
+		{"jsonpointer:/a~1b/c~0d", []string{"/a/b/c~d"}, []string{"/a~1b/c~0d"}},
+		{"jsonpath:$.features.*.properties.debug", []string{"/features/x/properties/debug/trace"}, []string{"/features/x/debug"}},
+		{"jsonpath:$..unwanted", []string{"/unwanted", "/a/b/unwanted/c"}, []string{"/a/unwanted2"}},
+		{"jsonpath:$.code[0].value", []string{"/code/0/value"}, []string{"/code/1/value", "/code/10/value"}},
+		{"jsonpath:$.code[*]['value','x']", []string{"/code/3/value", "/code/1/x"}, []string{"/code/1/y"}},
+		{"jsonpath:$.code[1:3]", []string{"/code/1", "/code/2/a"}, []string{"/code/0", "/code/3"}},
+		{"jsonpath:$['a.b'][0,2]", []string{"/a.b/0", "/a.b/2"}, []string{"/a.b/1", "/aXb/0"}},
+	}
+	for _, test := range tests {
+		settings := new(CloudSettings)
+		settings.PayloadFilters = PayloadFiltersType{test.filter}
+		require.NoError(t, settings.CompileFilters(), test.filter)
+
+		for _, path := range test.matches {
+			assert.True(t, settings.PayloadFiltersRegexp[0].MatchString(path), "%s - %s", test.filter, path)
+		}
+		for _, path := range test.skips {
+			assert.False(t, settings.PayloadFiltersRegexp[0].MatchString(path), "%s - %s", test.filter, path)
+		}
+	}
+}
+
+func TestPayloadFilterSyntaxInvalid(t *testing.T) {
+	filters := []string{
+		"regex:[",
+		"jsonpointer:features",
+		"jsonpath:features",
+		"jsonpath:$.",
+		"jsonpath:$..",
+		"jsonpath:$[0",
+		"jsonpath:$[-1]",
+		"jsonpath:$[?(@.a)]",
+		"jsonpath:$[2:1]",
+		"jsonpath:$[1:]",
+		"jsonpath:$x",
+	}
+	for _, filter := range filters {
+		settings := new(CloudSettings)
+		settings.PayloadFilters = PayloadFiltersType{filter}
+		assert.Error(t, settings.CompileFilters(), filter)
+	}
+}
+
 func TestTopicFilter(t *testing.T) {
 	settings := new(CloudSettings)
 	settings.TopicFilter = "test"
@@ -74,6 +125,382 @@ func TestTopicFilterInvalid(t *testing.T) {
 	require.Empty(t, settings.TopicFilterRegexp)
 }
 
+func TestTopicFilters(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.TopicFilters = []TopicFilterRule{
+		{Action: TopicFilterAllow, Topic: "^test/device/"},
+		{Action: TopicFilterDeny, Topic: ".*"},
+	}
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.MessageFilterSettings.Validate())
+	assert.True(t, settings.TopicFilters[0].Matches("test/device/things/twin/events/modified"))
+	assert.False(t, settings.TopicFilters[0].Matches("test/device:child/things/twin/events/modified"))
+}
+
+func TestTopicFiltersInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.TopicFilters = []TopicFilterRule{{Action: TopicFilterDeny, Topic: "["}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.TopicFilters = []TopicFilterRule{{Action: TopicFilterDeny}}
+	require.Error(t, settings.MessageFilterSettings.Validate())
+
+	settings.TopicFilters = []TopicFilterRule{{Action: "block", Topic: ".*"}}
+	require.Error(t, settings.MessageFilterSettings.Validate())
+}
+
+func TestScopedPayloadFilters(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.ScopedPayloadFilters = []ScopedPayloadFilter{
+		{Thing: "^test:device:a$", Feature: "^meter$", Mode: PayloadFilterInclude, Paths: PayloadFiltersType{"/status$"}},
+	}
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.MessageFilterSettings.Validate())
+
+	filter := settings.ScopedPayloadFilters[0]
+	assert.True(t, filter.MatchesThing("test:device:a"))
+	assert.False(t, filter.MatchesThing("test:device:b"))
+	assert.True(t, filter.Excludes("meter", "/features/meter/properties/serial"))
+	assert.False(t, filter.Excludes("meter", "/features/meter/properties/status"))
+	assert.False(t, filter.Excludes("other", "/features/other/properties/serial"))
+	assert.False(t, filter.Excludes("", "/attributes/serial"))
+
+	settings.ScopedPayloadFilters = []ScopedPayloadFilter{{Thing: "["}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.ScopedPayloadFilters = []ScopedPayloadFilter{{Paths: PayloadFiltersType{"["}}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.ScopedPayloadFilters = []ScopedPayloadFilter{{Mode: PayloadFilterExclude}}
+	require.Error(t, settings.MessageFilterSettings.Validate())
+
+	settings.ScopedPayloadFilters = []ScopedPayloadFilter{{Mode: "keep", Paths: PayloadFiltersType{"/x$"}}}
+	require.Error(t, settings.MessageFilterSettings.Validate())
+}
+
+func TestBasicIngestRules(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.BasicIngestRules = []BasicIngestRule{
+		{RuleName: "telemetry_rule", Class: MessageClassTelemetry, Feature: "^meter$", Subject: "heatUp"},
+	}
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.BasicIngestSettings.Validate())
+
+	rule := settings.BasicIngestRules[0]
+	assert.NotNil(t, rule.FeatureRegexp)
+	assert.NotNil(t, rule.SubjectRegexp)
+	assert.Nil(t, rule.TopicRegexp)
+	assert.True(t, rule.Matches(MessageClassTelemetry, "test/device/things/live/messages/heatUp", "meter", "heatUp"))
+	assert.False(t, rule.Matches(MessageClassEvents, "test/device/things/live/messages/heatUp", "meter", "heatUp"))
+	assert.False(t, rule.Matches(MessageClassTelemetry, "test/device/things/live/messages/heatUp", "other", "heatUp"))
+}
+
+func TestBasicIngestRulesInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.BasicIngestRules = []BasicIngestRule{{RuleName: "rule", Topic: "["}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.BasicIngestRules = []BasicIngestRule{{RuleName: "invalid-rule"}}
+	require.Error(t, settings.BasicIngestSettings.Validate())
+
+	settings.BasicIngestRules = []BasicIngestRule{{RuleName: "rule", Class: "shadow"}}
+	require.Error(t, settings.BasicIngestSettings.Validate())
+}
+
+func TestOutputFormatsInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.OutputFormats = []OutputFormatRule{{Topic: "[", Format: OutputFormatValue}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.OutputFormats = []OutputFormatRule{{Format: "raw"}}
+	require.Error(t, settings.OutputFormatSettings.Validate())
+
+	settings.OutputFormats = []OutputFormatRule{{Format: OutputFormatEnvelope}, {Format: OutputFormatValue}}
+	require.NoError(t, settings.OutputFormatSettings.Validate())
+}
+
+func TestTransformationsInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.Transformations = []TransformRule{{Operation: TransformRemove, Field: "/x", Path: "["}}
+	require.Error(t, settings.CompileFilters())
+
+	invalid := []TransformRule{
+		{Operation: "copy", Field: "/x"},
+		{Operation: TransformRemove},
+		{Operation: TransformRename, Field: "/x", Target: "/y/z"},
+		{Operation: TransformMove, Field: "/x"},
+		{Operation: TransformMove, Field: "/x", Target: "/*/y"},
+		{Operation: TransformConvert, Field: "/x"},
+	}
+	for _, rule := range invalid {
+		settings.Transformations = []TransformRule{rule}
+		assert.Error(t, settings.TransformSettings.Validate(), rule.Operation)
+	}
+
+	settings.Transformations = []TransformRule{
+		{Operation: TransformRename, Field: "/x", Target: "y"},
+		{Operation: TransformMove, Field: "/*/x", Target: "/y/x"},
+		{Operation: TransformSet, Field: "/x", Value: 1},
+		{Operation: TransformConvert, Field: "/x", Scale: 0.001},
+	}
+	assert.NoError(t, settings.TransformSettings.Validate())
+}
+
+func TestRouteConditions(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.RouteConditions = []RouteCondition{{Class: MessageClassEvents, Condition: `headers["severity"] >= 3`}}
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.RouteConditionSettings.Validate())
+
+	routed, err := settings.RouteConditions[0].Evaluate(&ConditionEnv{Headers: map[string]interface{}{"severity": 4}})
+	require.NoError(t, err)
+	assert.True(t, routed)
+	assert.True(t, settings.RouteConditions[0].Matches(MessageClassEvents))
+	assert.False(t, settings.RouteConditions[0].Matches(MessageClassShadow))
+}
+
+func TestRouteConditionsInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.RouteConditions = []RouteCondition{{Condition: `value >`}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.RouteConditions = []RouteCondition{{Condition: `unknown == 1`}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.RouteConditions = []RouteCondition{{Condition: `topic`}}
+	require.Error(t, settings.CompileFilters())
+
+	settings.RouteConditions = []RouteCondition{{Class: "commands", Condition: `true`}}
+	require.Error(t, settings.RouteConditionSettings.Validate())
+
+	settings.RouteConditions = []RouteCondition{{Name: "empty"}}
+	require.Error(t, settings.RouteConditionSettings.Validate())
+}
+
+func TestDeadbandsInvalid(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.Deadbands = []DeadbandRule{{Path: "["}}
+	require.Error(t, settings.CompileFilters())
+
+	invalid := []DeadbandRule{
+		{},
+		{Path: "/temperature$", Absolute: -1},
+		{Path: "/temperature$", Percent: -1},
+		{Path: "/temperature$", MinInterval: -1},
+		{Path: "/temperature$", MaxInterval: -1},
+		{Path: "/temperature$", MinInterval: 1000, MaxInterval: 500},
+	}
+	for _, rule := range invalid {
+		settings.Deadbands = []DeadbandRule{rule}
+		assert.Error(t, settings.DeadbandSettings.Validate())
+	}
+
+	settings.Deadbands = []DeadbandRule{{Path: "/temperature$", Absolute: 0.5, MinInterval: 1000, MaxInterval: 60000}}
+	assert.NoError(t, settings.DeadbandSettings.Validate())
+}
+
+func TestCommandRoutes(t *testing.T) {
+	settings := new(CloudSettings)
+	settings.CommandRoutes = []CommandRoute{{Topic: "cmd/{site}/+/{operation}/#", Subject: "{operation}", Timeout: "500ms"}}
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.CommandSettings.Validate())
+
+	route := &settings.CommandRoutes[0]
+	assert.Equal(t, "cmd/+/+/+/#", route.Filter())
+	values, ok := route.Values("cmd/plant/dispenser/dispense/now/1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"site": "plant", "operation": "dispense"}, values)
+	_, ok = route.Values("cmd/plant/dispenser")
+	assert.False(t, ok)
+}
+
+func TestCommandRoutesInvalid(t *testing.T) {
+	for _, topic := range []string{"cmd/x{site}", "cmd/{site}/{site}", "cmd/{1site}", "cmd/a+", "cmd/#/x"} {
+		settings := new(CloudSettings)
+		settings.CommandRoutes = []CommandRoute{{Topic: topic, Subject: "open"}}
+		assert.Error(t, settings.CompileFilters(), topic)
+	}
+
+	invalid := []CommandRoute{
+		{Subject: "open"},
+		{Topic: "cmd/{site}"},
+		{Topic: "cmd/{site}", Subject: "{unknown}"},
+		{Topic: "cmd/{site}", Subject: "open", Value: map[string]interface{}{"a": []interface{}{"{unknown}"}}},
+		{Topic: "cmd/{site}", Subject: "open", ReplyTopic: "reply/+"},
+		{Topic: "cmd/{site}", Subject: "open", ReplyTopic: "reply/{payload}"},
+		{Topic: "cmd/{site}", Subject: "open", ReplyFormat: "xml"},
+		{Topic: "cmd/{site}", Subject: "open", Timeout: "s"},
+		{Topic: "cmd/{site}", Subject: "open", Timeout: "1h"},
+		{Topic: "cmd/{site}", Subject: "open", Timeout: "3600s"},
+	}
+	for _, route := range invalid {
+		settings := new(CloudSettings)
+		settings.CommandRoutes = []CommandRoute{route}
+		require.NoError(t, settings.CompileFilters())
+		assert.Error(t, settings.CommandSettings.Validate())
+	}
+
+	settings := new(CloudSettings)
+	settings.CommandTimeout = -1
+	assert.Error(t, settings.CommandSettings.Validate())
+
+	settings = new(CloudSettings)
+	settings.CommandDedupWindow = -1
+	assert.Error(t, settings.CommandSettings.Validate())
+}
+
+func TestCommandPolicy(t *testing.T) {
+	policy, err := LoadCommandPolicy(commandPolicyFile(t, `{
+		"rules": [
+			{"action": "deny", "subject": "^reboot$", "sender": "^guest$"},
+			{"action": "allow", "thing": "^test:device$", "feature": "^door$"},
+			{"action": "allow", "subject": "^reboot$"}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, TopicFilterDeny, policy.Default)
+	assert.Equal(t, DefaultCommandSenderHeader, policy.SenderHeader)
+
+	allowed, rule := policy.Allows("test:device", "door", "open", "")
+	assert.True(t, allowed)
+	assert.Equal(t, &policy.Rules[1], rule)
+	allowed, rule = policy.Allows("test:device", "", "reboot", "guest")
+	assert.False(t, allowed)
+	assert.Equal(t, &policy.Rules[0], rule)
+	allowed, _ = policy.Allows("test:device", "", "reboot", "admin")
+	assert.True(t, allowed)
+	allowed, rule = policy.Allows("test:device:child", "door", "open", "")
+	assert.False(t, allowed)
+	assert.Nil(t, rule)
+
+	settings := new(CloudSettings)
+	require.NoError(t, settings.ReadCommandPolicy())
+	assert.Nil(t, settings.CommandPolicy)
+	settings.CommandPolicyFile = commandPolicyFile(t, `{"default": "allow", "senderHeader": "x-sender"}`)
+	require.NoError(t, settings.ReadCommandPolicy())
+	require.NotNil(t, settings.CommandPolicy)
+	allowed, _ = settings.CommandPolicy.Allows("test:device", "", "open", "")
+	assert.True(t, allowed)
+	assert.Equal(t, "x-sender", settings.CommandPolicy.SenderHeader)
+}
+
+func TestCommandPolicyInvalid(t *testing.T) {
+	invalid := []string{
+		`[]`,
+		`{"default": "block"}`,
+		`{"senderHeader": ""}`,
+		`{"rules": [{"subject": "open"}]}`,
+		`{"rules": [{"action": "allow", "thing": "test:("}]}`,
+	}
+	for _, policy := range invalid {
+		_, err := LoadCommandPolicy(commandPolicyFile(t, policy))
+		assert.Error(t, err, policy)
+	}
+
+	_, err := LoadCommandPolicy("unknown.json")
+	assert.Error(t, err)
+}
+
+func TestAuditSettings(t *testing.T) {
+	settings := &AuditSettings{AuditPayload: "unknown"}
+	assert.NoError(t, settings.Validate())
+
+	valid := AuditSettings{AuditFile: "audit.log", AuditFileSize: 1, AuditFileCount: 1}
+	for _, payload := range []string{AuditPayloadNone, AuditPayloadHash, AuditPayloadFull} {
+		settings := valid
+		settings.AuditPayload = payload
+		assert.NoError(t, settings.Validate(), payload)
+	}
+
+	invalid := []AuditSettings{
+		{AuditFile: "audit.log", AuditFileSize: 0, AuditFileCount: 1, AuditPayload: AuditPayloadNone},
+		{AuditFile: "audit.log", AuditFileSize: 1, AuditFileCount: 0, AuditPayload: AuditPayloadNone},
+		{AuditFile: "audit.log", AuditFileSize: 1, AuditFileCount: 1, AuditPayload: "unknown"},
+	}
+	for _, settings := range invalid {
+		assert.Error(t, settings.Validate())
+	}
+}
+
+func TestGatewaySettings(t *testing.T) {
+	settings := &GatewaySettings{ChildThingNameTemplate: DefaultChildThingNameTemplate}
+	require.NoError(t, settings.Validate())
+	assert.Equal(t, "ns:device", settings.ThingName("ns:device", "ns:device:door"))
+
+	settings.GatewayMode = true
+	require.NoError(t, settings.Validate())
+	assert.Equal(t, "ns:device", settings.ThingName("ns:device", "ns:device"))
+	assert.Equal(t, "ns:device", settings.ThingName("ns:device", "ns:other"))
+	assert.Equal(t, "ns:device:door", settings.ThingName("ns:device", "ns:device:door"))
+
+	settings.ChildThingNameTemplate = "{namespace}_{entityName}"
+	require.NoError(t, settings.Validate())
+	assert.Equal(t, "ns_device:door", settings.ThingName("ns:device", "ns:device:door"))
+
+	settings.ChildThingNameTemplate = "{deviceId}-{childId}"
+	require.NoError(t, settings.Validate())
+	assert.Equal(t, "ns:device-door:front", settings.ThingName("ns:device", "ns:device:door:front"))
+
+	for _, template := range []string{"", "{thingId}/child", "child+", "{feature}"} {
+		settings.ChildThingNameTemplate = template
+		assert.Error(t, settings.Validate(), template)
+	}
+}
+
+func TestGatewaySettingsChildRegistration(t *testing.T) {
+	settings := &GatewaySettings{
+		ChildThingNameTemplate:    DefaultChildThingNameTemplate,
+		ChildRegistration:         true,
+		ChildProvisioningTemplate: "child-template",
+		ChildRegistrationTimeout:  DefaultChildRegistrationTimeout,
+	}
+	assert.Error(t, settings.Validate())
+
+	settings.GatewayMode = true
+	require.NoError(t, settings.Validate())
+
+	for _, template := range []string{"", "child/template", "child#"} {
+		settings.ChildProvisioningTemplate = template
+		assert.Error(t, settings.Validate(), template)
+	}
+
+	settings.ChildProvisioningTemplate = "child-template"
+	settings.ChildRegistrationTimeout = 0
+	assert.Error(t, settings.Validate())
+}
+
+func TestRegistrySettings(t *testing.T) {
+	settings := &RegistrySettings{}
+	require.NoError(t, settings.Validate())
+
+	settings.RegistryAttributes = AttributeNamesType{"serial", ThingGroupsAttribute}
+	assert.Error(t, settings.Validate())
+	settings.RegistryRule = "registry_sync"
+	require.NoError(t, settings.Validate())
+
+	settings.RegistryRule = "registry-sync"
+	assert.Error(t, settings.Validate())
+
+	settings.RegistryRule = "registry_sync"
+	for _, name := range []string{"", "location/floor", "serial number"} {
+		settings.RegistryAttributes = AttributeNamesType{name}
+		assert.Error(t, settings.Validate(), name)
+	}
+
+	names := AttributeNamesType{}
+	assert.Equal(t, "[]", names.String())
+	require.NoError(t, names.Set("serial"))
+	require.NoError(t, names.Set("model"))
+	assert.Equal(t, "['serial', 'model']", names.String())
+	assert.NotNil(t, names.Get())
+}
+
+func commandPolicyFile(t *testing.T, policy string) string {
+	file := t.TempDir() + "/policy.json"
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0600))
+	return file
+}
+
 func TestConfigEmpty(t *testing.T) {
 	f, err := os.CreateTemp("", "configEmpty*.json")
 	require.NoError(t, err)
@@ -114,6 +541,82 @@ func TestConfigInvalid(t *testing.T) {
 	settings.LocalAddress = "tcp://localhost:1883"
 	settings.CACert = "missing.crt"
 	assert.Error(t, settings.Validate(), "Expected - failed to read CA certificates file")
+
+	settings.CACert = ""
+	settings.TelemetryQos = 2
+	assert.Error(t, settings.Validate(), "Expected - unsupported telemetryQos value")
+
+	settings.TelemetryQos = 1
+	settings.CommandResponsesQos = -1
+	assert.Error(t, settings.Validate(), "Expected - unsupported commandResponsesQos value")
+
+	settings.CommandResponsesQos = 1
+	settings.RateLimit = -1
+	assert.Error(t, settings.Validate(), "Expected - rateLimit < 0")
+
+	settings.RateLimit = 100
+	settings.RateLimitBurst = 0
+	assert.Error(t, settings.Validate(), "Expected - rateLimitBurst <= 0")
+
+	settings.RateLimitBurst = 100
+	settings.RateLimitMaxDelay = -1
+	assert.Error(t, settings.Validate(), "Expected - rateLimitMaxDelay < 0")
+
+	settings.RateLimitMaxDelay = 5000
+	settings.TelemetryBatchWindow = -1
+	assert.Error(t, settings.Validate(), "Expected - telemetryBatchWindow < 0")
+
+	settings.TelemetryBatchWindow = 1000
+	settings.TelemetryBatchMaxBytes = -1
+	assert.Error(t, settings.Validate(), "Expected - telemetryBatchMaxBytes < 0")
+
+	settings.TelemetryBatchMaxBytes = 0
+	settings.Compression = "lz4"
+	assert.Error(t, settings.Validate(), "Expected - unsupported compression")
+
+	settings.Compression = CompressionGzip
+	settings.CompressionClasses = "telemetry,shadow"
+	assert.Error(t, settings.Validate(), "Expected - unsupported compression class")
+
+	settings.CompressionClasses = "telemetry,events"
+	settings.CompressionThreshold = -1
+	assert.Error(t, settings.Validate(), "Expected - compressionThreshold < 0")
+
+	settings.CompressionThreshold = 0
+	settings.TelemetryTopicTemplate = "dt/{deviceId}/{unknown}"
+	assert.Error(t, settings.Validate(), "Expected - invalid telemetryTopicTemplate")
+
+	settings.TelemetryTopicTemplate = ""
+	settings.EventsTopicTemplate = "evt/{device}"
+	assert.Error(t, settings.Validate(), "Expected - invalid eventsTopicTemplate")
+
+	settings.EventsTopicTemplate = "evt/{deviceId}/{subject}"
+	settings.SiteWiseTopic = "sitewise/ingest"
+	settings.SiteWiseAliasTemplate = "/{thingId}/{unknown}"
+	assert.Error(t, settings.Validate(), "Expected - invalid siteWiseAliasTemplate")
+
+	settings.SiteWiseAliasTemplate = ""
+	assert.Error(t, settings.Validate(), "Expected - siteWiseAliasTemplate is missing")
+
+	settings.SiteWiseAliasTemplate = DefaultSiteWiseAliasTemplate
+	settings.SiteWiseWindow = -1
+	assert.Error(t, settings.Validate(), "Expected - siteWiseWindow < 0")
+
+	settings.SiteWiseWindow = 0
+	settings.LiveTopicTemplate = "things/{thingId}/live/{unknown}"
+	assert.Error(t, settings.Validate(), "Expected - invalid liveTopicTemplate")
+
+	settings.LiveTopicTemplate = "things/+/live/{subject}"
+	assert.Error(t, settings.Validate(), "Expected - wildcards in liveTopicTemplate")
+
+	settings.LiveTopicTemplate = "things/{thingId}/live/{subject}"
+	assert.NoError(t, settings.Validate())
+}
+
+func TestTopicTemplateFilter(t *testing.T) {
+	assert.Equal(t, "things/+/live/+", TopicTemplateFilter("things/{thingId}/live/{subject}"))
+	assert.Equal(t, "dev/+/live", TopicTemplateFilter("/dev/x-{deviceId}/live/"))
+	assert.Equal(t, "things/a:b/live", ExpandTopicTemplate("things/{thingId}/live/{subject}", map[string]string{PlaceholderThingID: "a:b"}))
 }
 
 func TestConfig(t *testing.T) {
@@ -127,6 +630,7 @@ func TestConfig(t *testing.T) {
 	expSettings.LogLevel = logger.DEBUG
 	expSettings.PayloadFilters = append(expSettings.PayloadFilters, ".*", "test")
 	expSettings.TopicFilter = "test"
+	expSettings.TelemetryQos = 0
 
 	settings := DefaultSettings()
 	require.NoError(t, suiteConfig.ReadConfig(testConfig, settings))
@@ -155,4 +659,40 @@ func TestDefaults(t *testing.T) {
 	defLogSettings := defConnectorSettings.LogSettings
 	defLogSettings.LogFile = "logs/aws-connector.log"
 	assert.Equal(t, defLogSettings, settings.LogSettings)
+
+	defQosSettings := QosSettings{
+		TelemetryQos:           1,
+		EventsQos:              1,
+		ShadowUpdatesQos:       1,
+		ShadowSubscriptionsQos: 0,
+		CommandsQos:            0,
+		CommandResponsesQos:    1,
+	}
+	assert.Equal(t, defQosSettings, settings.QosSettings)
+
+	defRateLimitSettings := RateLimitSettings{
+		RateLimitBurst:    100,
+		RateLimitMaxDelay: 5000,
+	}
+	assert.Equal(t, defRateLimitSettings, settings.RateLimitSettings)
+	defCommandSettings := CommandSettings{
+		CommandTimeout:        DefaultCommandTimeout,
+		CommandDedupFile:      DefaultCommandDedupFile,
+		CommandDedupByPayload: true,
+	}
+	assert.Equal(t, defCommandSettings, settings.CommandSettings)
+
+	defAuditSettings := AuditSettings{
+		AuditFileSize:  2,
+		AuditFileCount: 5,
+		AuditPayload:   AuditPayloadNone,
+	}
+	assert.Equal(t, defAuditSettings, settings.AuditSettings)
+	defGatewaySettings := GatewaySettings{
+		ChildThingsFile:          DefaultChildThingsFile,
+		ChildThingNameTemplate:   DefaultChildThingNameTemplate,
+		ChildRegistrationTimeout: DefaultChildRegistrationTimeout,
+		ChildRegistrationsFile:   DefaultChildRegistrationsFile,
+	}
+	assert.Equal(t, defGatewaySettings, settings.GatewaySettings)
 }
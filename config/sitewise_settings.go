@@ -0,0 +1,42 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DefaultSiteWiseAliasTemplate is the default template of the AWS IoT SiteWise property aliases.
+const DefaultSiteWiseAliasTemplate = "/{namespace}/{entityName}/{feature}/{property}"
+
+// SiteWiseSettings represents the conversion of the telemetry messages to AWS IoT SiteWise property values.
+// The property values are grouped per alias within the SiteWise time window, zero window disables the grouping.
+type SiteWiseSettings struct {
+	SiteWiseTopic         string `json:"siteWiseTopic"`
+	SiteWiseAliasTemplate string `json:"siteWiseAliasTemplate"`
+	SiteWiseWindow        int    `json:"siteWiseWindow"`
+}
+
+// Validate validates the SiteWise settings, empty topic disables the conversion.
+func (settings *SiteWiseSettings) Validate() error {
+	if len(settings.SiteWiseTopic) == 0 {
+		return nil
+	}
+	if len(settings.SiteWiseAliasTemplate) == 0 {
+		return errors.New("siteWiseAliasTemplate is missing")
+	}
+	if settings.SiteWiseWindow < 0 {
+		return errors.New("siteWiseWindow < 0")
+	}
+	return errors.Wrap(validateTemplate(settings.SiteWiseAliasTemplate, PlaceholderProperty), "invalid siteWiseAliasTemplate")
+}
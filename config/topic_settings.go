@@ -0,0 +1,117 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Placeholders supported by the topic templates.
+const (
+	PlaceholderDeviceID   = "deviceId"
+	PlaceholderTenantID   = "tenantId"
+	PlaceholderThingID    = "thingId"
+	PlaceholderNamespace  = "namespace"
+	PlaceholderEntityName = "entityName"
+	PlaceholderFeature    = "feature"
+	PlaceholderAction     = "action"
+	PlaceholderSubject    = "subject"
+	PlaceholderClass      = "class"
+	PlaceholderProperty   = "property"
+	PlaceholderThingName  = "thingName"
+	PlaceholderChildID    = "childId"
+)
+
+// PlaceholderRegexp matches the placeholders in format {name} of the topic templates.
+var PlaceholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+var placeholders = map[string]bool{
+	PlaceholderDeviceID:   true,
+	PlaceholderTenantID:   true,
+	PlaceholderThingID:    true,
+	PlaceholderNamespace:  true,
+	PlaceholderEntityName: true,
+	PlaceholderFeature:    true,
+	PlaceholderAction:     true,
+	PlaceholderSubject:    true,
+	PlaceholderClass:      true,
+	PlaceholderThingName:  true,
+}
+
+// TopicTemplateSettings represents the AWS IoT topic templates of the telemetry and event messages.
+type TopicTemplateSettings struct {
+	TelemetryTopicTemplate string `json:"telemetryTopicTemplate"`
+	EventsTopicTemplate    string `json:"eventsTopicTemplate"`
+}
+
+// Validate validates the topic templates, empty template keeps the default topic.
+func (settings *TopicTemplateSettings) Validate() error {
+	if err := validateTemplate(settings.TelemetryTopicTemplate); err != nil {
+		return errors.Wrap(err, "invalid telemetryTopicTemplate")
+	}
+	return errors.Wrap(validateTemplate(settings.EventsTopicTemplate), "invalid eventsTopicTemplate")
+}
+
+// ExpandTemplate replaces the template placeholders with their values, unknown placeholders are removed.
+func ExpandTemplate(template string, values map[string]string) string {
+	return PlaceholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return values[placeholder[1:len(placeholder)-1]]
+	})
+}
+
+// ExpandTopicTemplate expands the topic template and skips the topic levels of the placeholders without value.
+func ExpandTopicTemplate(template string, values map[string]string) string {
+	levels := []string{}
+	for _, level := range strings.Split(ExpandTemplate(template, values), "/") {
+		if len(level) > 0 {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// TopicTemplateFilter returns the MQTT topic filter that matches the expanded topics of the topic template.
+// Each topic level that contains a placeholder is replaced with a single-level wildcard.
+func TopicTemplateFilter(template string) string {
+	levels := []string{}
+	for _, level := range strings.Split(template, "/") {
+		if PlaceholderRegexp.MatchString(level) {
+			level = "+"
+		}
+		if len(level) > 0 {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+func validateTemplate(template string, extra ...string) error {
+	for _, match := range PlaceholderRegexp.FindAllStringSubmatch(template, -1) {
+		if !placeholders[match[1]] && !contains(extra, match[1]) {
+			return errors.Errorf("unknown placeholder '%s'", match[0])
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Operations supported by the payload transformation rules.
+const (
+	TransformRename  = "rename"
+	TransformMove    = "move"
+	TransformSet     = "set"
+	TransformRemove  = "remove"
+	TransformConvert = "convert"
+)
+
+// TransformWildcard matches any key of a transformation field path level.
+const TransformWildcard = "*"
+
+// TransformSettings represents the payload transformations applied to the messages before sending them toward AWS IoT.
+type TransformSettings struct {
+	Transformations []TransformRule `json:"transformations"`
+}
+
+// TransformRule represents a single payload transformation of the messages with matching Ditto topic and path.
+// The field and target are slash separated paths relative to the thing, e.g. /features/meter/properties/power.
+type TransformRule struct {
+	Topic       string         `json:"topic"`
+	TopicRegexp *regexp.Regexp `json:"-"`
+	Path        string         `json:"path"`
+	PathRegexp  *regexp.Regexp `json:"-"`
+	Operation   string         `json:"operation"`
+	Field       string         `json:"field"`
+	Target      string         `json:"target"`
+	Value       interface{}    `json:"value"`
+	Scale       float64        `json:"scale"`
+	Offset      float64        `json:"offset"`
+}
+
+// Matches returns true if the rule matches the provided Ditto topic and path.
+func (rule *TransformRule) Matches(topic, path string) bool {
+	if rule.TopicRegexp != nil && !rule.TopicRegexp.MatchString(topic) {
+		return false
+	}
+	return rule.PathRegexp == nil || rule.PathRegexp.MatchString(path)
+}
+
+// compile prepares the regex filters of the rule.
+func (rule *TransformRule) compile() (err error) {
+	if rule.TopicRegexp, err = compileOptional(rule.Topic); err != nil {
+		return err
+	}
+	rule.PathRegexp, err = compileOptional(rule.Path)
+	return err
+}
+
+// Validate validates the payload transformation rules.
+func (settings *TransformSettings) Validate() error {
+	for i, rule := range settings.Transformations {
+		if err := rule.validate(); err != nil {
+			return errors.Wrapf(err, "invalid transformation %d", i)
+		}
+	}
+	return nil
+}
+
+func (rule *TransformRule) validate() error {
+	if len(strings.Trim(rule.Field, "/")) == 0 {
+		return errors.New("field is missing")
+	}
+
+	switch rule.Operation {
+	case TransformRemove, TransformSet:
+		return nil
+
+	case TransformRename:
+		if len(rule.Target) == 0 || strings.Contains(rule.Target, "/") {
+			return errors.Errorf("invalid rename target '%s', expected a field name", rule.Target)
+		}
+		return nil
+
+	case TransformMove:
+		target := strings.Trim(rule.Target, "/")
+		if len(target) == 0 {
+			return errors.New("move target is missing")
+		}
+		for _, level := range strings.Split(target, "/") {
+			if level == TransformWildcard {
+				return errors.Errorf("wildcard not allowed in move target '%s'", rule.Target)
+			}
+		}
+		return nil
+
+	case TransformConvert:
+		if rule.Scale == 0 {
+			return errors.New("convert scale is missing")
+		}
+		return nil
+
+	default:
+		return errors.Errorf("unsupported transformation operation '%s'", rule.Operation)
+	}
+}
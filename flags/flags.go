@@ -31,5 +31,45 @@ func Add(f *flag.FlagSet, settings *config.CloudSettings) {
 	f.StringVar(&settings.ClientID, "clientId", def.ClientID, "Remote client `ID`")
 	f.StringVar(&settings.TenantID, "tenantId", def.TenantID, "Tenant `ID`")
 	f.StringVar(&settings.TopicFilter, "topicFilter", def.TopicFilter, "Regex filter used to block incoming messages by their topic")
-	f.Var(&settings.PayloadFilters, "payloadFilters", "Regex filters used to exclude parts of the incoming messages payload")
+	f.Var(&settings.PayloadFilters, "payloadFilters", "Regex, JSON Pointer (jsonpointer: prefix) or JSONPath (jsonpath: prefix) filters used to exclude parts of the incoming messages payload")
+	f.IntVar(&settings.TelemetryQos, "telemetryQos", def.TelemetryQos, "QoS level (0 or 1) used for publishing telemetry messages")
+	f.IntVar(&settings.EventsQos, "eventsQos", def.EventsQos, "QoS level (0 or 1) used for publishing event messages")
+	f.IntVar(&settings.ShadowUpdatesQos, "shadowUpdatesQos", def.ShadowUpdatesQos, "QoS level (0 or 1) used for publishing device shadow updates")
+	f.IntVar(&settings.ShadowSubscriptionsQos, "shadowSubscriptionsQos", def.ShadowSubscriptionsQos, "QoS level (0 or 1) used for subscribing to device shadow topics")
+	f.IntVar(&settings.CommandsQos, "commandsQos", def.CommandsQos, "QoS level (0 or 1) used for subscribing to commands")
+	f.IntVar(&settings.CommandResponsesQos, "commandResponsesQos", def.CommandResponsesQos, "QoS level (0 or 1) used for publishing command responses")
+	f.Float64Var(&settings.RateLimit, "rateLimit", def.RateLimit, "Maximum number of messages per second published toward AWS IoT, 0 disables the rate limiting")
+	f.IntVar(&settings.RateLimitBurst, "rateLimitBurst", def.RateLimitBurst, "Maximum number of messages published toward AWS IoT in a single burst")
+	f.IntVar(&settings.RateLimitMaxDelay, "rateLimitMaxDelay", def.RateLimitMaxDelay, "Maximum delay in milliseconds of a low priority message before it is dropped by the rate limiter")
+	f.IntVar(&settings.TelemetryBatchWindow, "telemetryBatchWindow", def.TelemetryBatchWindow, "Time window in milliseconds for grouping telemetry messages into a single message, 0 disables the batching")
+	f.IntVar(&settings.TelemetryBatchMaxBytes, "telemetryBatchMaxBytes", def.TelemetryBatchMaxBytes, "Maximum size in bytes of the grouped telemetry messages, 0 means no size limit")
+	f.StringVar(&settings.TelemetryTopicTemplate, "telemetryTopicTemplate", def.TelemetryTopicTemplate, "AWS IoT topic template of the telemetry messages, e.g. dt/{deviceId}/{feature}")
+	f.StringVar(&settings.EventsTopicTemplate, "eventsTopicTemplate", def.EventsTopicTemplate, "AWS IoT topic template of the event messages, e.g. evt/{deviceId}/{subject}")
+	f.StringVar(&settings.SiteWiseTopic, "siteWiseTopic", def.SiteWiseTopic, "AWS IoT topic of the telemetry converted to SiteWise property values, empty disables the conversion")
+	f.StringVar(&settings.SiteWiseAliasTemplate, "siteWiseAliasTemplate", def.SiteWiseAliasTemplate, "SiteWise property alias template of the feature properties")
+	f.IntVar(&settings.SiteWiseWindow, "siteWiseWindow", def.SiteWiseWindow, "Time window in milliseconds for grouping the SiteWise property values per alias, 0 disables the grouping")
+	f.StringVar(&settings.LiveTopicTemplate, "liveTopicTemplate", def.LiveTopicTemplate, "AWS IoT topic template of the forwarded Ditto live messages and events, empty disables the forwarding")
+	f.BoolVar(&settings.AwsCommands, "awsCommands", def.AwsCommands, "Handle the AWS IoT commands sent to the device as Ditto live messages")
+	f.IntVar(&settings.CommandTimeout, "commandTimeout", def.CommandTimeout, "Timeout in milliseconds of the commands without Ditto timeout header, unanswered commands are responded with a Ditto 408 error")
+	f.StringVar(&settings.CommandPolicyFile, "commandPolicyFile", def.CommandPolicyFile, "Authorization policy `file` of the commands sent to the device, empty allows all commands")
+	f.IntVar(&settings.CommandDedupWindow, "commandDedupWindow", def.CommandDedupWindow, "Time window in milliseconds for dropping the redelivered commands, 0 disables the deduplication")
+	f.StringVar(&settings.CommandDedupFile, "commandDedupFile", def.CommandDedupFile, "State `file` persisting the command dedup window across restarts, empty keeps it in memory only")
+	f.BoolVar(&settings.CommandDedupByPayload, "commandDedupByPayload", def.CommandDedupByPayload, "Deduplicate the commands without correlation ID by the hash of their topic and payload")
+	f.StringVar(&settings.AuditFile, "auditFile", def.AuditFile, "Audit log `file` of the commands sent to the device and their responses, empty disables the audit log")
+	f.IntVar(&settings.AuditFileSize, "auditFileSize", def.AuditFileSize, "Audit log file size in MB before it gets rotated")
+	f.IntVar(&settings.AuditFileCount, "auditFileCount", def.AuditFileCount, "Audit log file max rotations count")
+	f.StringVar(&settings.AuditPayload, "auditPayload", def.AuditPayload, "Payload capture (none, hash or full) of the audited commands and responses")
+	f.BoolVar(&settings.KnownChildThings, "knownChildThings", def.KnownChildThings, "Forward the commands only to the child things created by the local applications, unknown child things are responded with a Ditto 404 error")
+	f.StringVar(&settings.ChildThingsFile, "childThingsFile", def.ChildThingsFile, "State `file` persisting the registry of the child things across restarts, empty keeps it in memory only")
+	f.BoolVar(&settings.GatewayMode, "gatewayMode", def.GatewayMode, "Represent each child thing by its own AWS IoT thing instead of named shadows of the device thing")
+	f.StringVar(&settings.ChildThingNameTemplate, "childThingNameTemplate", def.ChildThingNameTemplate, "AWS IoT thing name template of the child things in gateway mode, e.g. {namespace}_{entityName}")
+	f.BoolVar(&settings.ChildRegistration, "childRegistration", def.ChildRegistration, "Register the AWS IoT things of the new child things through the child provisioning template in gateway mode")
+	f.StringVar(&settings.ChildProvisioningTemplate, "childProvisioningTemplate", def.ChildProvisioningTemplate, "AWS IoT fleet provisioning template `name` used for the child things registration")
+	f.IntVar(&settings.ChildRegistrationTimeout, "childRegistrationTimeout", def.ChildRegistrationTimeout, "Time in milliseconds to wait for a child thing registration response")
+	f.StringVar(&settings.ChildRegistrationsFile, "childRegistrationsFile", def.ChildRegistrationsFile, "State `file` persisting the AWS IoT thing names of the registered child things, empty keeps them in memory only")
+	f.Var(&settings.RegistryAttributes, "registryAttributes", "Ditto thing `attribute` synced to the AWS IoT registry, the thingGroups attribute is mapped to the thing groups membership")
+	f.StringVar(&settings.RegistryRule, "registryRule", def.RegistryRule, "AWS IoT rule `name` receiving the registry attributes and thing groups updates via its Basic Ingest topics")
+	f.StringVar(&settings.Compression, "compression", def.Compression, "Payload compression algorithm (gzip or zstd) of the messages sent toward AWS IoT, empty disables the compression")
+	f.StringVar(&settings.CompressionClasses, "compressionClasses", def.CompressionClasses, "Comma separated message classes (telemetry, events) with compressed payload")
+	f.IntVar(&settings.CompressionThreshold, "compressionThreshold", def.CompressionThreshold, "Minimum payload size in bytes to be compressed")
 }
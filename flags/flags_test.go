@@ -88,6 +88,46 @@ func TestFlagsSet(t *testing.T) {
 		"tpmKeyPub",
 		"topicFilter",
 		"payloadFilters",
+		"telemetryQos",
+		"eventsQos",
+		"shadowUpdatesQos",
+		"shadowSubscriptionsQos",
+		"commandsQos",
+		"commandResponsesQos",
+		"rateLimit",
+		"rateLimitBurst",
+		"rateLimitMaxDelay",
+		"telemetryBatchWindow",
+		"telemetryBatchMaxBytes",
+		"telemetryTopicTemplate",
+		"eventsTopicTemplate",
+		"siteWiseTopic",
+		"siteWiseAliasTemplate",
+		"siteWiseWindow",
+		"liveTopicTemplate",
+		"awsCommands",
+		"commandTimeout",
+		"commandPolicyFile",
+		"commandDedupWindow",
+		"commandDedupFile",
+		"commandDedupByPayload",
+		"auditFile",
+		"auditFileSize",
+		"auditFileCount",
+		"auditPayload",
+		"knownChildThings",
+		"childThingsFile",
+		"gatewayMode",
+		"childThingNameTemplate",
+		"childRegistration",
+		"childProvisioningTemplate",
+		"childRegistrationTimeout",
+		"childRegistrationsFile",
+		"registryAttributes",
+		"registryRule",
+		"compression",
+		"compressionClasses",
+		"compressionThreshold",
 	}
 	for _, flagName := range flagNames {
 		assertFlagExists(t, flagName, f)
@@ -4,11 +4,16 @@ go 1.17
 
 require (
 	github.com/ThreeDotsLabs/watermill v1.3.2
+	github.com/antonmedv/expr v1.10.5
 	github.com/eclipse-kanto/suite-connector v0.1.0-M3.0.20240129092345-aa6991f27391
 	github.com/eclipse/ditto-clients-golang v0.0.0-20220225085802-cf3b306280d3
+	github.com/hashicorp/go-multierror v1.1.1
 	github.com/imdario/mergo v0.3.12
+	github.com/klauspost/compress v1.15.15
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
 require (
@@ -21,7 +26,6 @@ require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
-	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/lithammer/shortuuid/v3 v3.0.7 // indirect
 	github.com/oklog/ulid v1.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -33,7 +37,5 @@ require (
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
 	golang.org/x/sys v0.20.0 // indirect
-	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4 // indirect
-	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
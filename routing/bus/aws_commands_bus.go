@@ -0,0 +1,359 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/pkg/errors"
+)
+
+const (
+	awsCommandsHandlerName = "aws_commands_request_handler"
+
+	// AWS IoT command execution topics, in format $aws/commands/things/<thingName>/executions/<executionId>/...
+	topicAwsCommandRequest  = "$aws/commands/things/%s/executions/+/request/#"
+	topicAwsCommandResponse = "$aws/commands/things/%s/executions/%s/response/json"
+
+	// Local command request topics, in format command//<thingId>/req/<correlationId>/<subject>.
+	topicLocalCommandRequest      = "command//%s/req/%s/%s"
+	topicLocalShortCommandRequest = "c//%s/q/%s/%s"
+
+	payloadFormatJSON = "json"
+	contentTypeJSON   = "application/json"
+
+	// AWS IoT command execution statuses.
+	executionSucceeded = "SUCCEEDED"
+	executionFailed    = "FAILED"
+	executionTimedOut  = "TIMED_OUT"
+
+	// Key of the Ditto response value in the command execution result.
+	executionResultResponse = "response"
+
+	// Additional time the command execution is kept after its timeout expiration.
+	executionGracePeriod = 5 * time.Second
+)
+
+// liveCommand represents a command converted to a Ditto live message, it is also the JSON payload of the AWS IoT commands.
+// The thingId defaults to the device ID, the timeout is in Ditto format, e.g. 30s.
+type liveCommand struct {
+	ThingID string      `json:"thingId"`
+	Feature string      `json:"feature"`
+	Subject string      `json:"subject"`
+	Value   interface{} `json:"value"`
+	Timeout string      `json:"timeout"`
+}
+
+// commandResponder converts the Ditto response of a cached command to its AWS IoT response topic and payload.
+type commandResponder interface {
+	response(env *protocol.Envelope, payload []byte) (string, []byte, error)
+}
+
+// commandExecution represents an AWS IoT command execution waiting for its Ditto response.
+type commandExecution struct {
+	thingName   string
+	executionID string
+}
+
+// executionResponse represents the AWS IoT command execution response.
+type executionResponse struct {
+	Status       string                    `json:"status"`
+	StatusReason *executionStatusReason    `json:"statusReason,omitempty"`
+	Result       map[string]executionValue `json:"result,omitempty"`
+}
+
+type executionStatusReason struct {
+	ReasonCode        string `json:"reasonCode"`
+	ReasonDescription string `json:"reasonDescription,omitempty"`
+}
+
+type executionValue struct {
+	S string `json:"s"`
+}
+
+// AwsCommandsReqBus creates the AWS IoT commands request bus.
+// The command executions are converted to Ditto live messages and tracked until their response.
+func AwsCommandsReqBus(router *message.Router,
+	pub message.Publisher,
+	sub message.Subscriber,
+	tracker *CommandTracker,
+	policy *config.CommandPolicy,
+	children *ChildThings,
+	deviceID string,
+) *message.Handler {
+	handler := newAwsCommandRequestHandler(tracker, children, deviceID)
+	handler = tracker.dedup.requests(tracker.auditRequests(authorize(policy, tracker, knownThings(children, tracker, handler))))
+	topic := fmt.Sprintf(topicAwsCommandRequest, deviceID)
+	if children != nil && children.settings.GatewayMode {
+		// In gateway mode the child things are represented by their own AWS IoT things.
+		topic = fmt.Sprintf(topicAwsCommandRequest, "+")
+	}
+	return router.AddHandler(awsCommandsHandlerName, topic, sub, connector.TopicEmpty, pub, handler)
+}
+
+// newAwsCommandRequestHandler returns the handler function converting the AWS IoT commands to Ditto live messages.
+// In gateway mode the commands of the child things AWS IoT things are sent to the child things by default.
+// The command executions that cannot be converted are answered with FAILED status.
+func newAwsCommandRequestHandler(tracker *CommandTracker, children *ChildThings, deviceID string) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		topic, ok := connector.TopicFromCtx(msg.Context())
+		if !ok {
+			return nil, errors.New("no topic in context")
+		}
+
+		execution, format, err := parseExecutionTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := execution.toCommandMessages(tracker, children, deviceID, format, msg.Payload)
+		if err != nil {
+			tracker.logger.Info("Invalid AWS IoT command", watermill.LogFields{
+				"thing":     execution.thingName,
+				"execution": execution.executionID,
+				"reason":    err.Error(),
+			})
+			execution.fail(tracker, err)
+			return []*message.Message{}, nil
+		}
+		return result, nil
+	}
+}
+
+// toCommandMessages converts the AWS IoT command payload to a Ditto live message and tracks the command execution until its response.
+func (execution *commandExecution) toCommandMessages(tracker *CommandTracker,
+	children *ChildThings,
+	deviceID, format string,
+	payload []byte,
+) ([]*message.Message, error) {
+	if len(format) > 0 && format != payloadFormatJSON {
+		return nil, errors.Errorf("unsupported AWS IoT command payload format '%s'", format)
+	}
+
+	command := &liveCommand{}
+	if err := json.Unmarshal(payload, command); err != nil {
+		return nil, errors.Wrap(err, "invalid AWS IoT command")
+	}
+	if execution.thingName != deviceID {
+		// The commands of a child AWS IoT thing are forwarded to its own Ditto thing only.
+		thingID, ok := children.ThingID(execution.thingName)
+		if !ok {
+			return nil, errors.Errorf("unknown AWS IoT thing '%s'", execution.thingName)
+		}
+		if len(command.ThingID) > 0 && command.ThingID != thingID {
+			return nil, errors.Errorf("thing '%s' does not match AWS IoT thing '%s'", command.ThingID, execution.thingName)
+		}
+		command.ThingID = thingID
+	}
+
+	timeout, err := tracker.commandTimeout(command.Timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid AWS IoT command")
+	}
+	result, request, err := toCommandMessages(command, execution.executionID, deviceID, timeout, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid AWS IoT command")
+	}
+	tracker.put(request, timeout, execution)
+	return result, nil
+}
+
+// fail publishes the FAILED response of the command execution which cannot be converted to a Ditto live message.
+func (execution *commandExecution) fail(tracker *CommandTracker, cause error) {
+	response := &executionResponse{
+		Status: executionFailed,
+		StatusReason: &executionStatusReason{
+			ReasonCode:        fmt.Sprint(http.StatusBadRequest),
+			ReasonDescription: cause.Error(),
+		},
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		tracker.logger.Error("Cannot marshal AWS IoT command response", err, watermill.LogFields{"execution": execution.executionID})
+		return
+	}
+
+	topic := fmt.Sprintf(topicAwsCommandResponse, execution.thingName, execution.executionID)
+	if err := tracker.pub.Publish(topic, message.NewMessage(watermill.NewUUID(), payload)); err != nil {
+		tracker.logger.Error("Cannot publish command response", err, watermill.LogFields{"topic": topic})
+	}
+}
+
+// toCommandMessages converts the command to a Ditto live message published on the local command request topics.
+// The Ditto live message is returned along with the messages.
+func toCommandMessages(command *liveCommand,
+	correlationID, deviceID string,
+	timeout time.Duration,
+	responseRequired bool,
+) ([]*message.Message, *protocol.Envelope, error) {
+	if len(command.Subject) == 0 {
+		return nil, nil, errors.New("subject is missing")
+	}
+	if len(command.ThingID) == 0 {
+		command.ThingID = deviceID
+	}
+	if command.ThingID != deviceID && !strings.HasPrefix(command.ThingID, deviceID+":") {
+		return nil, nil, errors.Errorf("unknown thing '%s'", command.ThingID)
+	}
+
+	request := toLiveCommand(command, correlationID, timeout, responseRequired)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot marshal Ditto live message")
+	}
+
+	result := make([]*message.Message, 0, 2)
+	for _, template := range []string{topicLocalCommandRequest, topicLocalShortCommandRequest} {
+		msg := message.NewMessage(watermill.NewUUID(), payload)
+		msg.SetContext(connector.SetTopicToCtx(msg.Context(), fmt.Sprintf(template, command.ThingID, correlationID, command.Subject)))
+		result = append(result, msg)
+	}
+	return result, request, nil
+}
+
+// parseExecutionTopic returns the command execution and the payload format of the AWS IoT command request topic.
+func parseExecutionTopic(topic string) (*commandExecution, string, error) {
+	// $aws/commands/things/<thingName>/executions/<executionId>/request[/<format>]
+	segments := strings.Split(topic, "/")
+	if len(segments) < 7 || segments[4] != "executions" || segments[6] != "request" {
+		return nil, "", errors.Errorf("invalid AWS IoT command topic '%s'", topic)
+	}
+	format := ""
+	if len(segments) > 7 {
+		format = segments[7]
+	}
+	return &commandExecution{thingName: segments[3], executionID: segments[5]}, format, nil
+}
+
+// toLiveCommand converts the command to a Ditto live message with the provided correlation ID.
+func toLiveCommand(command *liveCommand, correlationID string, timeout time.Duration, responseRequired bool) *protocol.Envelope {
+	namespace, entityName := command.ThingID, ""
+	if i := strings.Index(command.ThingID, ":"); i >= 0 {
+		namespace, entityName = command.ThingID[:i], command.ThingID[i+1:]
+	}
+
+	topic := (&protocol.Topic{}).
+		WithNamespace(namespace).
+		WithEntityName(entityName).
+		WithGroup(protocol.GroupThings).
+		WithChannel(protocol.ChannelLive).
+		WithCriterion(protocol.CriterionMessages).
+		WithAction(protocol.TopicAction(command.Subject))
+
+	path := "/inbox/messages/" + command.Subject
+	if len(command.Feature) > 0 {
+		path = "/features/" + command.Feature + path
+	}
+
+	headers := protocol.NewHeaders(
+		protocol.WithCorrelationID(correlationID),
+		protocol.WithResponseRequired(responseRequired),
+		protocol.WithContentType(contentTypeJSON),
+		protocol.WithTimeout(toDittoTimeout(timeout)),
+	)
+
+	return (&protocol.Envelope{}).WithTopic(topic).WithHeaders(headers).WithPath(path).WithValue(command.Value)
+}
+
+// toDittoTimeout returns the Ditto timeout header value of the provided duration.
+func toDittoTimeout(timeout time.Duration) string {
+	if timeout%time.Second == 0 {
+		return fmt.Sprintf("%ds", timeout/time.Second)
+	}
+	return fmt.Sprintf("%dms", timeout/time.Millisecond)
+}
+
+// commandResponses creates middleware handler which publishes the Ditto responses of the tracked AWS IoT command executions
+// and routed commands to their AWS IoT response topic, all other responses are passed to the provided handler.
+func commandResponses(tracker *CommandTracker, h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if err := json.Unmarshal(msg.Payload, env); err != nil {
+			return h(msg)
+		}
+
+		correlationID := env.Headers.CorrelationID()
+		value, _ := tracker.reqCache.Get(correlationID)
+		responder, ok := value.(commandResponder)
+		if !ok {
+			msgs, err := h(msg)
+			if len(msgs) > 0 {
+				command, _ := tracker.done(correlationID)
+				tracker.responded(env, command, msgs[0])
+			}
+			return msgs, err
+		}
+		tracker.reqCache.Remove(correlationID)
+		command, _ := tracker.done(correlationID)
+
+		topic, payload, err := responder.response(env, msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		response := message.NewMessage(watermill.NewUUID(), payload)
+		response.SetContext(connector.SetTopicToCtx(msg.Context(), topic))
+		tracker.responded(env, command, response)
+		return []*message.Message{response}, nil
+	}
+}
+
+// response converts the Ditto response to the AWS IoT command execution response.
+func (execution *commandExecution) response(env *protocol.Envelope, payload []byte) (string, []byte, error) {
+	data, err := json.Marshal(toExecutionResponse(env))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "cannot marshal AWS IoT command response")
+	}
+	return fmt.Sprintf(topicAwsCommandResponse, execution.thingName, execution.executionID), data, nil
+}
+
+// toExecutionResponse converts the Ditto response to AWS IoT command execution response.
+// The 2xx statuses succeed, 408 times out and all other statuses fail, the Ditto response value is the execution result.
+func toExecutionResponse(env *protocol.Envelope) *executionResponse {
+	response := &executionResponse{
+		Status: executionFailed,
+		StatusReason: &executionStatusReason{
+			ReasonCode: fmt.Sprint(env.Status),
+		},
+	}
+
+	switch {
+	case env.Status >= http.StatusOK && env.Status < http.StatusMultipleChoices:
+		response.Status = executionSucceeded
+	case env.Status == http.StatusRequestTimeout:
+		response.Status = executionTimedOut
+	}
+
+	if errorValue, ok := env.Value.(map[string]interface{}); ok && response.Status != executionSucceeded {
+		if description, ok := errorValue["message"].(string); ok {
+			response.StatusReason.ReasonDescription = description
+		}
+	}
+
+	if env.Value != nil {
+		if data, err := json.Marshal(env.Value); err == nil {
+			response.Result = map[string]executionValue{executionResultResponse: {S: string(data)}}
+		}
+	}
+	return response
+}
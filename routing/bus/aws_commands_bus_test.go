@@ -0,0 +1,237 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	test "github.com/eclipse-kanto/aws-connector/routing/bus/internal/testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const executionTopic = "$aws/commands/things/test:device/executions/e1/request/json"
+
+func TestAwsCommandsReqBus(t *testing.T) {
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	AwsCommandsReqBus(router, connector.NullPublisher(), test.NewDummySubscriber(), tracker, nil, nil, deviceID)
+	refRouter := reflect.Indirect(reflect.ValueOf(router))
+	refHandlers := refRouter.FieldByName(fieldHandlers)
+	assert.Equal(t, 1, refHandlers.Len())
+	refHandler := refHandlers.MapIndex(refHandlers.MapKeys()[0])
+	test.AssertRouterHandler(t, awsCommandsHandlerName, "$aws/commands/things/test:device/executions/+/request/#", "", reflect.Indirect(refHandler))
+}
+
+func TestAwsCommandRequest(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+	h := newAwsCommandRequestHandler(tracker, nil, deviceID)
+
+	msgs, err := h(commandMessage(executionTopic, `{"thingId":"test:device:child","feature":"door","subject":"open","value":{"angle":90},"timeout":"10s"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device:child/req/e1/open")
+	assertMessageTopic(t, msgs[1], "c//test:device:child/q/e1/open")
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, env))
+	assert.Equal(t, "test/device:child/things/live/messages/open", env.Topic.String())
+	assert.Equal(t, "/features/door/inbox/messages/open", env.Path)
+	assert.Equal(t, map[string]interface{}{"angle": float64(90)}, env.Value)
+	assert.Equal(t, "e1", env.Headers.CorrelationID())
+	assert.Equal(t, "10s", env.Headers.Timeout())
+	assert.True(t, env.Headers.IsResponseRequired())
+
+	execution, ok := reqCache.Get("e1")
+	require.True(t, ok)
+	assert.Equal(t, &commandExecution{thingName: "test:device", executionID: "e1"}, execution)
+
+	msgs, err = h(commandMessage("$aws/commands/things/test:device/executions/e2/request", `{"subject":"reboot"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device/req/e2/reboot")
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, env))
+	assert.Equal(t, "/inbox/messages/reboot", env.Path)
+	assert.Equal(t, "60s", env.Headers.Timeout())
+}
+
+func TestAwsCommandsReqBusGatewayMode(t *testing.T) {
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	children := NewChildThings(deviceID, &config.GatewaySettings{GatewayMode: true, ChildThingNameTemplate: "{thingId}"}, watermill.NopLogger{})
+	AwsCommandsReqBus(router, connector.NullPublisher(), test.NewDummySubscriber(), tracker, nil, children, deviceID)
+	refRouter := reflect.Indirect(reflect.ValueOf(router))
+	refHandlers := refRouter.FieldByName(fieldHandlers)
+	assert.Equal(t, 1, refHandlers.Len())
+	refHandler := refHandlers.MapIndex(refHandlers.MapKeys()[0])
+	test.AssertRouterHandler(t, awsCommandsHandlerName, "$aws/commands/things/+/executions/+/request/#", "", reflect.Indirect(refHandler))
+}
+
+func TestAwsCommandRequestGatewayMode(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	settings := &config.GatewaySettings{
+		GatewayMode:            true,
+		ChildThingNameTemplate: "door-{childId}",
+		ChildThingsFile:        t.TempDir() + "/things.json",
+	}
+	children := NewChildThings(deviceID, settings, watermill.NopLogger{})
+	children.ThingCreated("test:device:front")
+	h := newAwsCommandRequestHandler(tracker, children, deviceID)
+
+	msgs, err := h(commandMessage("$aws/commands/things/door-front/executions/e1/request", `{"feature":"lock","subject":"open"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device:front/req/e1/open")
+
+	execution, ok := reqCache.Get("e1")
+	require.True(t, ok)
+	assert.Equal(t, &commandExecution{thingName: "door-front", executionID: "e1"}, execution)
+
+	assertAwsCommandFailed(t, h, pub, "$aws/commands/things/door-back/executions/e2/request", `{"subject":"open"}`)
+
+	children.ThingCreated("test:device:back")
+	assertAwsCommandFailed(t, h, pub, "$aws/commands/things/door-front/executions/e3/request", `{"thingId":"test:device:back","subject":"open"}`)
+	assertAwsCommandFailed(t, h, pub, "$aws/commands/things/door-front/executions/e4/request", `{"thingId":"test:device","subject":"open"}`)
+
+	msgs, err = h(commandMessage("$aws/commands/things/door-front/executions/e5/request", `{"thingId":"test:device:front","subject":"open"}`))
+	require.NoError(t, err)
+	assertMessageTopic(t, msgs[0], "command//test:device:front/req/e5/open")
+}
+
+func TestAwsCommandRequestInvalid(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+	h := newAwsCommandRequestHandler(tracker, nil, deviceID)
+
+	// not answered without the execution ID
+	_, err := h(message.NewMessage("test", []byte(`{"subject":"open"}`)))
+	assert.Error(t, err)
+	_, err = h(commandMessage("$aws/commands/things/test:device/executions", `{"subject":"open"}`))
+	assert.Error(t, err)
+	assert.Empty(t, pub.published())
+
+	assertAwsCommandFailed(t, h, pub, "$aws/commands/things/test:device/executions/e1/request/cbor", `{"subject":"open"}`)
+	assertAwsCommandFailed(t, h, pub, executionTopic, `not json`)
+	assertAwsCommandFailed(t, h, pub, executionTopic, `{"feature":"door"}`)
+	assertAwsCommandFailed(t, h, pub, executionTopic, `{"thingId":"test:devices","subject":"open"}`)
+	for _, timeout := range []string{"s", "1h", "60m", "-1s"} {
+		assertAwsCommandFailed(t, h, pub, executionTopic, `{"subject":"open","timeout":"`+timeout+`"}`)
+	}
+	assert.Equal(t, 0, reqCache.Size())
+	assert.Equal(t, 0, tracker.Status().Pending)
+}
+
+func assertAwsCommandFailed(t *testing.T, h message.HandlerFunc, pub *topicPublisher, topic string, payload string) {
+	count := len(pub.published())
+	msgs, err := h(commandMessage(topic, payload))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	published := pub.published()
+	require.Equal(t, count+1, len(published))
+	response := &executionResponse{}
+	require.NoError(t, json.Unmarshal([]byte(published[count].payload), response))
+	assert.Equal(t, executionFailed, response.Status)
+	assert.Equal(t, "400", response.StatusReason.ReasonCode)
+	assert.NotEmpty(t, response.StatusReason.ReasonDescription)
+
+	segments := strings.Split(topic, "/")
+	assert.Equal(t, fmt.Sprintf(topicAwsCommandResponse, segments[3], segments[5]), published[count].topic)
+}
+
+func TestAwsCommandResponses(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+	h := newAwsCommandRequestHandler(tracker, nil, deviceID)
+	_, err := h(commandMessage(executionTopic, `{"subject":"open"}`))
+	require.NoError(t, err)
+
+	responses := commandResponses(tracker, message.PassthroughHandler)
+
+	msgs, err := responses(commandMessage("command//test:device/res/e1/200", `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"e1"},"status":200,"value":{"opened":true}}`))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assertMessageTopic(t, msgs[0], "$aws/commands/things/test:device/executions/e1/response/json")
+	assert.JSONEq(t, `{"status":"SUCCEEDED","statusReason":{"reasonCode":"200"},"result":{"response":{"s":"{\"opened\":true}"}}}`, string(msgs[0].Payload))
+
+	_, ok := reqCache.Get("e1")
+	assert.False(t, ok)
+
+	// Not an AWS IoT command execution
+	reqCache.Put("c1", true, time.Minute)
+	msg := commandMessage("command//test:device/res/c1/200", `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"c1"},"status":200}`)
+	msgs, err = responses(msg)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assert.Equal(t, msg, msgs[0])
+}
+
+func TestToExecutionResponse(t *testing.T) {
+	response := toExecutionResponse(&protocol.Envelope{Status: 408, Value: map[string]interface{}{"message": "no answer"}})
+	assert.Equal(t, executionTimedOut, response.Status)
+	assert.Equal(t, "408", response.StatusReason.ReasonCode)
+	assert.Equal(t, "no answer", response.StatusReason.ReasonDescription)
+
+	response = toExecutionResponse(&protocol.Envelope{Status: 500})
+	assert.Equal(t, executionFailed, response.Status)
+	assert.Nil(t, response.Result)
+
+	response = toExecutionResponse(&protocol.Envelope{Status: 204})
+	assert.Equal(t, executionSucceeded, response.Status)
+}
+
+func commandMessage(topic, payload string) *message.Message {
+	msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+	msg.SetContext(connector.SetTopicToCtx(context.Background(), topic))
+	return msg
+}
+
+func assertMessageTopic(t *testing.T, msg *message.Message, expected string) {
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	require.True(t, ok)
+	assert.Equal(t, expected, topic)
+}
@@ -0,0 +1,508 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/pkg/errors"
+)
+
+const (
+	childRegistrationHandlerName = "child_registration_handler"
+
+	// AWS IoT fleet provisioning topics, in format $aws/provisioning-templates/<templateName>/provision/json[/accepted|/rejected].
+	topicProvisioningRequest = "$aws/provisioning-templates/%s/provision/json"
+	provisioningAccepted     = "accepted"
+	provisioningRejected     = "rejected"
+
+	// AWS IoT fleet provisioning topic creating the certificate from a certificate signing request,
+	// whose ownership token is required by the register thing request.
+	topicCreateCertificate = "$aws/certificates/create-from-csr/json"
+
+	// Provisioning template parameters of the child thing registration.
+	parameterThingName = "ThingName"
+	parameterThingID   = "ThingId"
+	parameterDeviceID  = "DeviceId"
+
+	// Maximum number of messages held per child thing until its registration is completed.
+	maxHeldMessages = 1000
+)
+
+// provisioningRequest represents the AWS IoT fleet provisioning register thing request.
+type provisioningRequest struct {
+	CertificateOwnershipToken string            `json:"certificateOwnershipToken"`
+	Parameters                map[string]string `json:"parameters"`
+}
+
+// certificateRequest represents the AWS IoT fleet provisioning create certificate from CSR request.
+type certificateRequest struct {
+	CertificateSigningRequest string `json:"certificateSigningRequest"`
+}
+
+// certificateResponse represents the AWS IoT fleet provisioning create certificate from CSR response, either accepted or rejected.
+type certificateResponse struct {
+	CertificateID             string `json:"certificateId"`
+	CertificateOwnershipToken string `json:"certificateOwnershipToken"`
+	StatusCode                int    `json:"statusCode"`
+	ErrorCode                 string `json:"errorCode"`
+	ErrorMessage              string `json:"errorMessage"`
+}
+
+// provisioningResponse represents the AWS IoT fleet provisioning register thing response, either accepted or rejected.
+type provisioningResponse struct {
+	ThingName    string `json:"thingName"`
+	StatusCode   int    `json:"statusCode"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// pendingRegistration represents a child thing waiting for the registration of its AWS IoT thing.
+// The registration is in progress once the certificate is requested and it is provisioning once the thing is requested.
+type pendingRegistration struct {
+	thingID      string
+	thingName    string
+	provisioning bool
+}
+
+// registrationRequest represents a certificate or register thing request, sent once the registration lock is released.
+type registrationRequest struct {
+	pub     message.Publisher
+	thingID string
+	topic   string
+	payload interface{}
+}
+
+// childRegistration registers the AWS IoT things of the new child things by invoking the child provisioning template
+// over MQTT. A certificate is created first from a certificate signing request, as its ownership token is required by
+// the register thing request, the certificate is not used by the child things and its key is discarded. The provisioning
+// responses are not correlated to their requests, thus the registrations are processed one at a time, only the accepted
+// responses of the expected AWS IoT thing complete them and the rejected responses fail the registration in progress.
+// The requests are sent without holding the registration lock, as the publisher may be rate limited. The messages of the child things are held until their registration is completed, the registered AWS IoT thing
+// names are persisted to the child registrations file, if configured.
+type childRegistration struct {
+	deviceID string
+	topic    string
+	timeout  time.Duration
+	file     string
+	logger   watermill.LoggerAdapter
+
+	mutex    sync.Mutex
+	pub      message.Publisher
+	started  bool
+	names    map[string]string
+	queue    []pendingRegistration
+	inflight *pendingRegistration
+	timer    *time.Timer
+	held     map[string][]*message.Message
+}
+
+func newChildRegistration(deviceID string, settings *config.GatewaySettings, logger watermill.LoggerAdapter) *childRegistration {
+	registration := &childRegistration{
+		deviceID: deviceID,
+		topic:    fmt.Sprintf(topicProvisioningRequest, settings.ChildProvisioningTemplate),
+		timeout:  time.Duration(settings.ChildRegistrationTimeout) * time.Millisecond,
+		file:     settings.ChildRegistrationsFile,
+		logger:   logger,
+		names:    make(map[string]string),
+		held:     make(map[string][]*message.Message),
+	}
+	if err := registration.load(); err != nil {
+		logger.Error("Cannot load child registrations file", err, watermill.LogFields{"file": registration.file})
+	}
+	return registration
+}
+
+// ChildRegistrationBus creates the bus processing the registration responses of the child things and queues the registrations
+// of the child things created locally before a restart. The registration requests and the held messages of the registered child
+// things are sent to the provided publisher, once the child things registration is started.
+func ChildRegistrationBus(router *message.Router, pub message.Publisher, sub message.Subscriber, children *ChildThings) *message.Handler {
+	if children == nil || children.registration == nil {
+		return nil
+	}
+	registration := children.registration
+	topics := strings.Join([]string{
+		topicCreateCertificate + "/" + provisioningAccepted,
+		topicCreateCertificate + "/" + provisioningRejected,
+		registration.topic + "/" + provisioningAccepted,
+		registration.topic + "/" + provisioningRejected,
+	}, ",")
+	handler := router.AddHandler(childRegistrationHandlerName, topics, sub, connector.TopicEmpty, pub, registration.handle)
+
+	for _, thingID := range children.Things() {
+		registration.register(thingID, children.settings.ThingName(children.deviceID, thingID))
+	}
+	registration.setPublisher(pub)
+	return handler
+}
+
+// name returns the registered AWS IoT thing name of the child thing with the provided ID.
+func (c *childRegistration) name(thingID string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name, ok := c.names[thingID]
+	return name, ok
+}
+
+// register queues the registration of the child thing with the provided ID, unless it is already registered or pending.
+func (c *childRegistration) register(thingID, thingName string) {
+	c.mutex.Lock()
+	if _, ok := c.names[thingID]; ok || c.isPending(thingID) {
+		c.mutex.Unlock()
+		return
+	}
+	c.queue = append(c.queue, pendingRegistration{thingID: thingID, thingName: thingName})
+	c.logger.Debug("Child thing registration queued", watermill.LogFields{"thing": thingID, "thingName": thingName})
+	request := c.next()
+	c.mutex.Unlock()
+
+	c.send(request)
+}
+
+// remove forgets the registration of the deleted child thing with the provided ID and drops its held messages.
+// The AWS IoT thing itself is not deleted.
+func (c *childRegistration) remove(thingID string) {
+	c.mutex.Lock()
+	if _, ok := c.names[thingID]; ok {
+		delete(c.names, thingID)
+		c.save()
+	}
+	delete(c.held, thingID)
+	for i, pending := range c.queue {
+		if pending.thingID == thingID {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			break
+		}
+	}
+	request := c.fail(thingID)
+	c.mutex.Unlock()
+
+	c.send(request)
+}
+
+// hold holds the messages of the child thing with the provided ID until its registration is completed.
+// Returns false if the child thing is not waiting for its registration.
+func (c *childRegistration) hold(thingID string, msgs []*message.Message) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.isPending(thingID) {
+		return false
+	}
+	held := append(c.held[thingID], msgs...)
+	if dropped := len(held) - maxHeldMessages; dropped > 0 {
+		c.logger.Info("Held messages of child thing dropped", watermill.LogFields{"thing": thingID, "dropped": dropped})
+		held = held[dropped:]
+	}
+	c.held[thingID] = held
+	return true
+}
+
+// setPublisher sets the publisher of the registration requests.
+func (c *childRegistration) setPublisher(pub message.Publisher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pub = pub
+}
+
+// start sends the first pending registration request, e.g. once connected to AWS IoT.
+func (c *childRegistration) start() {
+	c.mutex.Lock()
+	c.started = true
+	request := c.next()
+	c.mutex.Unlock()
+
+	c.send(request)
+}
+
+// close stops the timer of the registration in progress.
+func (c *childRegistration) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.started = false
+}
+
+// handle processes the accepted or rejected certificate and registration responses and returns the held messages
+// of the registered child thing. As the responses are not correlated to their requests, a rejected response fails
+// the registration in progress, if it is waiting for such a response.
+func (c *childRegistration) handle(msg *message.Message) ([]*message.Message, error) {
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	if !ok {
+		return nil, errors.New("no message topic")
+	}
+	rejected := strings.HasSuffix(topic, "/"+provisioningRejected)
+	if strings.HasPrefix(topic, topicCreateCertificate+"/") {
+		response := new(certificateResponse)
+		if err := json.Unmarshal(msg.Payload, response); err != nil {
+			return nil, errors.Wrap(err, "invalid certificate response")
+		}
+		c.send(c.handleCertificate(rejected, response))
+		return []*message.Message{}, nil
+	}
+	response := new(provisioningResponse)
+	if err := json.Unmarshal(msg.Payload, response); err != nil {
+		return nil, errors.Wrap(err, "invalid provisioning response")
+	}
+	held, request := c.handleProvisioning(topic, rejected, response)
+	c.send(request)
+	return held, nil
+}
+
+// handleProvisioning processes the accepted or rejected register thing response, completes or fails the registration
+// in progress and returns the held messages of the registered child thing and the next registration request.
+func (c *childRegistration) handleProvisioning(
+	topic string, rejected bool, response *provisioningResponse,
+) ([]*message.Message, *registrationRequest) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if rejected {
+		c.logger.Error("Child thing registration rejected", nil, watermill.LogFields{
+			"statusCode":   response.StatusCode,
+			"errorCode":    response.ErrorCode,
+			"errorMessage": response.ErrorMessage,
+		})
+		if c.inflight == nil || !c.inflight.provisioning {
+			return []*message.Message{}, nil
+		}
+		return []*message.Message{}, c.fail(c.inflight.thingID)
+	}
+
+	if c.inflight == nil || !c.inflight.provisioning || response.ThingName != c.inflight.thingName {
+		c.logger.Info("Unexpected provisioning response dropped", watermill.LogFields{"topic": topic, "thingName": response.ThingName})
+		return []*message.Message{}, nil
+	}
+	pending := *c.inflight
+	c.timer.Stop()
+	c.inflight = nil
+
+	c.names[pending.thingID] = pending.thingName
+	c.save()
+	c.logger.Info("Child thing registered", watermill.LogFields{"thing": pending.thingID, "thingName": pending.thingName})
+
+	held := c.held[pending.thingID]
+	delete(c.held, pending.thingID)
+	if held == nil {
+		held = []*message.Message{}
+	}
+	return held, c.next()
+}
+
+// handleCertificate processes the accepted or rejected certificate response and returns the register thing request
+// of the registration in progress with the ownership token of the certificate, or the next registration request
+// if the certificate is rejected.
+func (c *childRegistration) handleCertificate(rejected bool, response *certificateResponse) *registrationRequest {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if rejected {
+		c.logger.Error("Child thing certificate rejected", nil, watermill.LogFields{
+			"statusCode":   response.StatusCode,
+			"errorCode":    response.ErrorCode,
+			"errorMessage": response.ErrorMessage,
+		})
+		if c.inflight == nil || c.inflight.provisioning {
+			return nil
+		}
+		return c.fail(c.inflight.thingID)
+	}
+
+	if c.inflight == nil || c.inflight.provisioning || len(response.CertificateOwnershipToken) == 0 {
+		c.logger.Info("Unexpected certificate response dropped", watermill.LogFields{"certificateId": response.CertificateID})
+		return nil
+	}
+	pending := c.inflight
+	pending.provisioning = true
+	return &registrationRequest{
+		pub:     c.pub,
+		thingID: pending.thingID,
+		topic:   c.topic,
+		payload: &provisioningRequest{
+			CertificateOwnershipToken: response.CertificateOwnershipToken,
+			Parameters: map[string]string{
+				parameterThingName: pending.thingName,
+				parameterThingID:   pending.thingID,
+				parameterDeviceID:  c.deviceID,
+			},
+		},
+	}
+}
+
+// expire fails the registration in progress if not responded within the registration timeout.
+func (c *childRegistration) expire(thingID string) {
+	c.mutex.Lock()
+	var request *registrationRequest
+	if c.inflight != nil && c.inflight.thingID == thingID {
+		c.logger.Error("Child thing registration timed out", nil, watermill.LogFields{"thing": thingID})
+		request = c.fail(thingID)
+	}
+	c.mutex.Unlock()
+
+	c.send(request)
+}
+
+// fail stops the registration in progress of the child thing with the provided ID, drops its held messages
+// and returns the next registration request. The caller must hold the registration lock.
+func (c *childRegistration) fail(thingID string) *registrationRequest {
+	if c.inflight == nil || c.inflight.thingID != thingID {
+		return nil
+	}
+	c.timer.Stop()
+	c.inflight = nil
+	c.drop(thingID)
+	return c.next()
+}
+
+// drop drops the held messages of the child thing, whose registration failed.
+func (c *childRegistration) drop(thingID string) {
+	if held := len(c.held[thingID]); held > 0 {
+		c.logger.Info("Held messages of unregistered child thing dropped", watermill.LogFields{"thing": thingID, "dropped": held})
+	}
+	delete(c.held, thingID)
+}
+
+// next starts the first queued child thing registration, if no registration is in progress, and returns
+// its certificate request. The caller must hold the registration lock and send the request once released.
+func (c *childRegistration) next() *registrationRequest {
+	for c.started && c.pub != nil && c.inflight == nil && len(c.queue) > 0 {
+		pending := c.queue[0]
+		c.queue = c.queue[1:]
+
+		csr, err := newCertificateSigningRequest(pending.thingName)
+		if err != nil {
+			c.logger.Error("Cannot create child thing certificate signing request", err, watermill.LogFields{"thing": pending.thingID})
+			c.drop(pending.thingID)
+			continue
+		}
+
+		c.inflight = &pending
+		c.timer = time.AfterFunc(c.timeout, func() {
+			c.expire(pending.thingID)
+		})
+		return &registrationRequest{
+			pub:     c.pub,
+			thingID: pending.thingID,
+			topic:   topicCreateCertificate,
+			payload: &certificateRequest{CertificateSigningRequest: csr},
+		}
+	}
+	return nil
+}
+
+// send sends the provided registration request to its AWS IoT topic, the registration lock must not be held.
+// If the request cannot be sent, its registration fails and the next registration request is sent instead.
+func (c *childRegistration) send(request *registrationRequest) {
+	for request != nil {
+		err := publishRequest(request.pub, request.topic, request.payload)
+		if err == nil {
+			c.logger.Debug("Child thing registration request sent", watermill.LogFields{"thing": request.thingID, "topic": request.topic})
+			return
+		}
+		c.logger.Error("Cannot send child thing registration request", err, watermill.LogFields{"thing": request.thingID, "topic": request.topic})
+
+		c.mutex.Lock()
+		request = c.fail(request.thingID)
+		c.mutex.Unlock()
+	}
+}
+
+// publishRequest sends the provided request to the AWS IoT topic.
+func publishRequest(pub message.Publisher, topic string, request interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), topic))
+	return pub.Publish(topic, msg)
+}
+
+// newCertificateSigningRequest creates a PEM encoded certificate signing request of the AWS IoT thing with a new key.
+// The key is discarded, as the certificate is not used by the child thing.
+func newCertificateSigningRequest(thingName string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: thingName}}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+func (c *childRegistration) isPending(thingID string) bool {
+	if c.inflight != nil && c.inflight.thingID == thingID {
+		return true
+	}
+	for _, pending := range c.queue {
+		if pending.thingID == thingID {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the registered AWS IoT thing names from the child registrations file.
+func (c *childRegistration) load() error {
+	if len(c.file) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(c.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &c.names); err != nil {
+		return errors.Wrap(err, "invalid child registrations file")
+	}
+	if c.names == nil {
+		c.names = make(map[string]string)
+	}
+	return nil
+}
+
+// save writes the registered AWS IoT thing names to the child registrations file.
+func (c *childRegistration) save() {
+	if len(c.file) == 0 {
+		return
+	}
+	if err := writeStateFile(c.file, c.names); err != nil {
+		c.logger.Error("Cannot save child registrations file", err, watermill.LogFields{"file": c.file})
+	}
+}
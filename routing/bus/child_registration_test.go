@@ -0,0 +1,324 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	test "github.com/eclipse-kanto/aws-connector/routing/bus/internal/testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	provisioningTopic = "$aws/provisioning-templates/child/provision/json"
+	certificateTopic  = "$aws/certificates/create-from-csr/json"
+)
+
+func registrationSettings(t *testing.T, timeout int) *config.GatewaySettings {
+	dir := t.TempDir()
+	return &config.GatewaySettings{
+		ChildThingsFile:           dir + "/things.json",
+		GatewayMode:               true,
+		ChildThingNameTemplate:    "{childId}",
+		ChildRegistration:         true,
+		ChildProvisioningTemplate: "child",
+		ChildRegistrationTimeout:  timeout,
+		ChildRegistrationsFile:    dir + "/registrations.json",
+	}
+}
+
+func TestChildRegistrationBus(t *testing.T) {
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	children := NewChildThings(deviceID, registrationSettings(t, 60000), watermill.NopLogger{})
+	defer children.Close()
+
+	require.NotNil(t, ChildRegistrationBus(router, &topicPublisher{}, test.NewDummySubscriber(), children))
+	refRouter := reflect.Indirect(reflect.ValueOf(router))
+	refHandlers := refRouter.FieldByName(fieldHandlers)
+	assert.Equal(t, 1, refHandlers.Len())
+	refHandler := refHandlers.MapIndex(refHandlers.MapKeys()[0])
+	topics := certificateTopic + "/accepted," + certificateTopic + "/rejected," + provisioningTopic + "/accepted," + provisioningTopic + "/rejected"
+	test.AssertRouterHandler(t, childRegistrationHandlerName, topics, "", reflect.Indirect(refHandler))
+
+	router, _ = message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	disabled := NewChildThings(deviceID, &config.GatewaySettings{GatewayMode: true}, watermill.NopLogger{})
+	assert.Nil(t, ChildRegistrationBus(router, &topicPublisher{}, test.NewDummySubscriber(), disabled))
+	test.AssertNoRouterHandlers(t, router)
+	assert.False(t, disabled.Hold("test:device:door", []*message.Message{newMessage("m1")}))
+	disabled.StartRegistration()
+	disabled.Close()
+
+	var nilChildren *ChildThings
+	assert.Nil(t, ChildRegistrationBus(router, &topicPublisher{}, test.NewDummySubscriber(), nilChildren))
+	assert.False(t, nilChildren.Hold("test:device:door", nil))
+	nilChildren.StartRegistration()
+	nilChildren.Close()
+}
+
+func TestChildRegistration(t *testing.T) {
+	settings := registrationSettings(t, 60000)
+	children := NewChildThings(deviceID, settings, watermill.NopLogger{})
+	defer children.Close()
+	pub := &topicPublisher{}
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+
+	children.ThingCreated("test:device:door")
+	children.ThingCreated("test:device:window")
+	assert.True(t, children.Hold("test:device:door", []*message.Message{newMessage("m1")}))
+	assert.True(t, children.Hold("test:device:window", []*message.Message{newMessage("m2")}))
+	assert.False(t, children.Hold(deviceID, []*message.Message{newMessage("m3")}))
+	assert.Empty(t, pub.published())
+
+	children.StartRegistration()
+	require.Equal(t, 1, len(pub.published()))
+	assertCertificateRequested(t, pub.published()[0], "door")
+
+	// provisioning response before the certificate
+	msgs, err := children.registration.handle(commandMessage(provisioningTopic+"/accepted", `{"thingName":"door"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	acceptCertificate(t, children, "token1")
+	require.Equal(t, 2, len(pub.published()))
+	assert.Equal(t, published{
+		topic:   provisioningTopic,
+		payload: `{"certificateOwnershipToken":"token1","parameters":{"DeviceId":"test:device","ThingId":"test:device:door","ThingName":"door"}}`,
+	}, pub.published()[1])
+
+	// late response of another thing
+	msgs, err = children.registration.handle(commandMessage(provisioningTopic+"/accepted", `{"thingName":"window"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.True(t, children.Hold("test:device:door", nil))
+
+	msgs, err = children.registration.handle(commandMessage(provisioningTopic+"/accepted", `{"deviceConfiguration":{},"thingName":"door"}`))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assert.Equal(t, "m1", msgs[0].UUID)
+	assert.False(t, children.Hold("test:device:door", []*message.Message{newMessage("m4")}))
+	assert.Equal(t, "door", children.ThingName("test:device:door"))
+
+	require.Equal(t, 3, len(pub.published()))
+	assertCertificateRequested(t, pub.published()[2], "window")
+	acceptCertificate(t, children, "token2")
+	require.Equal(t, 4, len(pub.published()))
+	assert.Equal(t, `{"certificateOwnershipToken":"token2","parameters":{"DeviceId":"test:device","ThingId":"test:device:window","ThingName":"window"}}`, pub.published()[3].payload)
+
+	// rejected registration fails the registration in progress
+	assert.True(t, children.Hold("test:device:window", []*message.Message{newMessage("m5")}))
+	msgs, err = children.registration.handle(commandMessage(provisioningTopic+"/rejected", `{"statusCode":400,"errorCode":"InvalidParameters","errorMessage":"rejected"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.False(t, children.Hold("test:device:window", []*message.Message{newMessage("m6")}))
+	_, ok := children.registration.name("test:device:window")
+	assert.False(t, ok)
+
+	// no registration in progress
+	msgs, err = children.registration.handle(commandMessage(certificateTopic+"/rejected", `{"statusCode":400,"errorCode":"InvalidPayload","errorMessage":"rejected"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	// already registered
+	children.ThingCreated("test:device:door")
+	assert.Equal(t, 4, len(pub.published()))
+
+	// unexpected certificate response
+	msgs, err = children.registration.handle(commandMessage(certificateTopic+"/accepted", `{"certificateId":"c1","certificateOwnershipToken":"token3"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.Equal(t, 4, len(pub.published()))
+
+	_, err = children.registration.handle(commandMessage(provisioningTopic+"/accepted", `not json`))
+	assert.Error(t, err)
+	_, err = children.registration.handle(commandMessage(certificateTopic+"/accepted", `not json`))
+	assert.Error(t, err)
+	_, err = children.registration.handle(message.NewMessage("m7", []byte(`{}`)))
+	assert.Error(t, err)
+}
+
+func TestChildRegistrationRestart(t *testing.T) {
+	settings := registrationSettings(t, 60000)
+	children := NewChildThings(deviceID, settings, watermill.NopLogger{})
+	pub := &topicPublisher{}
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+	children.StartRegistration()
+
+	children.ThingCreated("test:device:door")
+	acceptCertificate(t, children, "token1")
+	_, err := children.registration.handle(commandMessage(provisioningTopic+"/accepted", `{"thingName":"door"}`))
+	require.NoError(t, err)
+	children.ThingCreated("test:device:window")
+	children.Close()
+
+	// restarted
+	children = NewChildThings(deviceID, settings, watermill.NopLogger{})
+	defer children.Close()
+	assert.Equal(t, "door", children.ThingName("test:device:door"))
+	thingID, ok := children.ThingID("door")
+	assert.True(t, ok)
+	assert.Equal(t, "test:device:door", thingID)
+
+	pub = &topicPublisher{}
+	router, _ = message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+	assert.True(t, children.Hold("test:device:window", nil))
+	children.StartRegistration()
+	acceptCertificate(t, children, "token2")
+	require.Equal(t, 2, len(pub.published()))
+	assert.Equal(t, `{"certificateOwnershipToken":"token2","parameters":{"DeviceId":"test:device","ThingId":"test:device:window","ThingName":"window"}}`, pub.published()[1].payload)
+
+	children.ThingDeleted("test:device:door")
+	assert.Equal(t, "door", children.ThingName("test:device:door"))
+	children.ThingDeleted("test:device:window")
+	assert.False(t, children.Hold("test:device:window", nil))
+}
+
+func TestChildRegistrationRejected(t *testing.T) {
+	children := NewChildThings(deviceID, registrationSettings(t, 60000), watermill.NopLogger{})
+	defer children.Close()
+	pub := &topicPublisher{}
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+	children.StartRegistration()
+
+	children.ThingCreated("test:device:door")
+	children.ThingCreated("test:device:window")
+	assert.True(t, children.Hold("test:device:door", []*message.Message{newMessage("m1")}))
+
+	// provisioning rejected while waiting for the certificate
+	msgs, err := children.registration.handle(commandMessage(provisioningTopic+"/rejected", `{"statusCode":400}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.True(t, children.Hold("test:device:door", nil))
+
+	msgs, err = children.registration.handle(commandMessage(certificateTopic+"/rejected", `{"statusCode":400,"errorCode":"InvalidPayload","errorMessage":"rejected"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.False(t, children.Hold("test:device:door", nil))
+
+	// continued with the next registration
+	require.Equal(t, 2, len(pub.published()))
+	assertCertificateRequested(t, pub.published()[1], "window")
+	assert.True(t, children.Hold("test:device:window", nil))
+
+	// certificate rejected while provisioning
+	acceptCertificate(t, children, "token1")
+	msgs, err = children.registration.handle(commandMessage(certificateTopic+"/rejected", `{"statusCode":400}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.True(t, children.Hold("test:device:window", nil))
+}
+
+func TestChildRegistrationPublishUnlocked(t *testing.T) {
+	children := NewChildThings(deviceID, registrationSettings(t, 60000), watermill.NopLogger{})
+	defer children.Close()
+	pub := &blockingPublisher{release: make(chan struct{})}
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+	children.StartRegistration()
+
+	created := make(chan struct{})
+	go func() {
+		children.ThingCreated("test:device:door")
+		close(created)
+	}()
+
+	// the registry and the registration are not locked while publishing the certificate request
+	assert.Eventually(t, func() bool {
+		return children.Contains("test:device:door")
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "door", children.ThingName("test:device:door"))
+	assert.True(t, children.Hold("test:device:door", nil))
+
+	close(pub.release)
+	select {
+	case <-created:
+	case <-time.After(time.Second):
+		require.Fail(t, "child thing not created")
+	}
+}
+
+func TestChildRegistrationTimeout(t *testing.T) {
+	children := NewChildThings(deviceID, registrationSettings(t, 10), watermill.NopLogger{})
+	defer children.Close()
+	pub := &topicPublisher{}
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	ChildRegistrationBus(router, pub, test.NewDummySubscriber(), children)
+	children.StartRegistration()
+
+	children.ThingCreated("test:device:door")
+	children.ThingCreated("test:device:window")
+	assert.True(t, children.Hold("test:device:door", []*message.Message{newMessage("m1")}))
+
+	assert.Eventually(t, func() bool {
+		return len(pub.published()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, children.Hold("test:device:door", nil))
+
+	assert.Eventually(t, func() bool {
+		return !children.Hold("test:device:window", nil)
+	}, time.Second, 5*time.Millisecond)
+
+	// responded after the timeout
+	msgs, err := children.registration.handle(commandMessage(certificateTopic+"/accepted", `{"certificateOwnershipToken":"token1"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	msgs, err = children.registration.handle(commandMessage(provisioningTopic+"/accepted", `{"thingName":"window"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.Equal(t, "window", children.ThingName("test:device:window"))
+	_, ok := children.registration.name("test:device:window")
+	assert.False(t, ok)
+}
+
+type blockingPublisher struct {
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(topic string, messages ...*message.Message) error {
+	<-p.release
+	return nil
+}
+
+func (p *blockingPublisher) Close() error { return nil }
+
+func assertCertificateRequested(t *testing.T, request published, thingName string) {
+	assert.Equal(t, certificateTopic, request.topic)
+	payload := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(request.payload), &payload))
+	block, _ := pem.Decode([]byte(payload["certificateSigningRequest"]))
+	require.NotNil(t, block)
+	assert.Equal(t, "CERTIFICATE REQUEST", block.Type)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equal(t, thingName, csr.Subject.CommonName)
+}
+
+func acceptCertificate(t *testing.T, children *ChildThings, token string) {
+	msgs, err := children.registration.handle(commandMessage(certificateTopic+"/accepted", `{"certificateId":"c1","certificateOwnershipToken":"`+token+`"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/pkg/errors"
+)
+
+// Ditto error code of the commands sent to unknown child things.
+const errorCodeThingNotFound = "things:thing.notfound"
+
+// ChildThings is the registry of the device child things, observed from their creation and deletion
+// by the local applications. The registry is persisted to the child things file, if configured.
+// If child registration is enabled, the AWS IoT things of the new child things are registered as well.
+type ChildThings struct {
+	deviceID     string
+	settings     *config.GatewaySettings
+	file         string
+	registration *childRegistration
+	logger       watermill.LoggerAdapter
+
+	mutex  sync.RWMutex
+	things map[string]bool
+}
+
+// NewChildThings creates the child things registry of the provided device, the child things registered
+// before a restart are loaded from the child things file.
+func NewChildThings(deviceID string, settings *config.GatewaySettings, logger watermill.LoggerAdapter) *ChildThings {
+	file := settings.ChildThingsFile
+	registry := &ChildThings{
+		deviceID: deviceID,
+		settings: settings,
+		file:     file,
+		logger:   logger,
+		things:   make(map[string]bool),
+	}
+	if err := registry.load(); err != nil {
+		logger.Error("Cannot load child things file", err, watermill.LogFields{"file": file})
+	}
+	if settings.GatewayMode && settings.ChildRegistration {
+		registry.registration = newChildRegistration(deviceID, settings, logger)
+	}
+	return registry
+}
+
+// ThingCreated registers the child thing with the provided ID, the device itself and other things are ignored.
+func (r *ChildThings) ThingCreated(thingID string) {
+	if r == nil || !r.isChild(thingID) {
+		return
+	}
+
+	r.mutex.Lock()
+	if !r.things[thingID] {
+		r.things[thingID] = true
+		r.logger.Debug("Child thing registered", watermill.LogFields{"thing": thingID})
+		r.save()
+	}
+	r.mutex.Unlock()
+
+	// registered without holding the registry lock, as the registration request may be rate limited
+	if r.registration != nil {
+		r.registration.register(thingID, r.settings.ThingName(r.deviceID, thingID))
+	}
+}
+
+// ThingDeleted unregisters the child thing with the provided ID.
+func (r *ChildThings) ThingDeleted(thingID string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	if r.things[thingID] {
+		delete(r.things, thingID)
+		r.logger.Debug("Child thing unregistered", watermill.LogFields{"thing": thingID})
+		r.save()
+	}
+	r.mutex.Unlock()
+
+	if r.registration != nil {
+		r.registration.remove(thingID)
+	}
+}
+
+// Hold holds the messages of the child thing with the provided ID until the registration of its AWS IoT thing is completed.
+// Returns false if the messages can be forwarded, i.e. the child thing is not waiting for its registration.
+func (r *ChildThings) Hold(thingID string, msgs []*message.Message) bool {
+	if r == nil || r.registration == nil {
+		return false
+	}
+	return r.registration.hold(thingID, msgs)
+}
+
+// StartRegistration starts the registration of the queued child things, e.g. once connected to AWS IoT.
+func (r *ChildThings) StartRegistration() {
+	if r != nil && r.registration != nil {
+		r.registration.start()
+	}
+}
+
+// Close stops the child thing registration in progress.
+func (r *ChildThings) Close() {
+	if r != nil && r.registration != nil {
+		r.registration.close()
+	}
+}
+
+// Contains returns true if the thing with the provided ID is the device itself or its registered child thing.
+func (r *ChildThings) Contains(thingID string) bool {
+	if thingID == r.deviceID {
+		return true
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.things[thingID]
+}
+
+// Things returns the sorted IDs of the registered child things.
+func (r *ChildThings) Things() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.sorted()
+}
+
+// ThingName returns the AWS IoT thing name of the device or its child thing with the provided ID,
+// the registered name takes precedence over the child thing name template.
+func (r *ChildThings) ThingName(thingID string) string {
+	if r.registration != nil {
+		if name, ok := r.registration.name(thingID); ok {
+			return name
+		}
+	}
+	return r.settings.ThingName(r.deviceID, thingID)
+}
+
+// ThingID returns the ID of the device or its registered child thing represented by the AWS IoT thing with the provided name.
+func (r *ChildThings) ThingID(thingName string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	if thingName == r.deviceID {
+		return r.deviceID, true
+	}
+	for _, thingID := range r.Things() {
+		if r.ThingName(thingID) == thingName {
+			return thingID, true
+		}
+	}
+	return "", false
+}
+
+func (r *ChildThings) isChild(thingID string) bool {
+	return strings.HasPrefix(thingID, r.deviceID+":") && len(thingID) > len(r.deviceID)+1
+}
+
+func (r *ChildThings) sorted() []string {
+	things := make([]string, 0, len(r.things))
+	for thingID := range r.things {
+		things = append(things, thingID)
+	}
+	sort.Strings(things)
+	return things
+}
+
+// load reads the registered child things from the child things file.
+func (r *ChildThings) load() error {
+	if len(r.file) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var things []string
+	if err := json.Unmarshal(data, &things); err != nil {
+		return errors.Wrap(err, "invalid child things file")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, thingID := range things {
+		if r.isChild(thingID) {
+			r.things[thingID] = true
+		}
+	}
+	return nil
+}
+
+// save writes the registered child things to the child things file.
+func (r *ChildThings) save() {
+	if len(r.file) == 0 {
+		return
+	}
+	if err := writeStateFile(r.file, r.sorted()); err != nil {
+		r.logger.Error("Cannot save child things file", err, watermill.LogFields{"file": r.file})
+	}
+}
+
+// knownThings creates middleware handler which forwards only the Ditto commands of the device and its registered child things,
+// if known child things is enabled. The commands of unknown child things are not forwarded, they are responded with a Ditto 404
+// error toward AWS IoT.
+func knownThings(children *ChildThings, tracker *CommandTracker, h message.HandlerFunc) message.HandlerFunc {
+	if children == nil || !children.settings.KnownChildThings {
+		return h
+	}
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err != nil || len(msgs) == 0 {
+			return msgs, err
+		}
+
+		request := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if json.Unmarshal(msgs[0].Payload, request) != nil || request.Topic == nil {
+			return msgs, nil
+		}
+
+		thingID := fmt.Sprintf("%s:%s", request.Topic.Namespace, request.Topic.EntityName)
+		if children.Contains(thingID) {
+			return msgs, nil
+		}
+
+		tracker.logger.Info("Command to unknown child thing dropped", watermill.LogFields{
+			"correlation-id": request.Headers.CorrelationID(),
+			"thing":          thingID,
+		})
+		description := fmt.Sprintf("The Thing with ID '%s' could not be found.", thingID)
+		tracker.reject(request, http.StatusNotFound, errorCodeThingNotFound, description)
+		return []*message.Message{}, nil
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildThings(t *testing.T) {
+	file := t.TempDir() + "/state/things.json"
+	children := NewChildThings(deviceID, &config.GatewaySettings{ChildThingsFile: file}, watermill.NopLogger{})
+	assert.True(t, children.Contains(deviceID))
+	assert.False(t, children.Contains("test:device:door"))
+
+	children.ThingCreated("test:device:door")
+	children.ThingCreated("test:device:window")
+	children.ThingCreated("test:device")
+	children.ThingCreated("test:devices:door")
+	children.ThingCreated("test:device:")
+	assert.True(t, children.Contains("test:device:door"))
+	assert.Equal(t, []string{"test:device:door", "test:device:window"}, children.Things())
+
+	children.ThingDeleted("test:device:window")
+	assert.False(t, children.Contains("test:device:window"))
+
+	// restarted
+	children = NewChildThings(deviceID, &config.GatewaySettings{ChildThingsFile: file}, watermill.NopLogger{})
+	assert.Equal(t, []string{"test:device:door"}, children.Things())
+
+	require.NoError(t, os.WriteFile(file, []byte(`{}`), 0600))
+	children = NewChildThings(deviceID, &config.GatewaySettings{ChildThingsFile: file}, watermill.NopLogger{})
+	assert.Empty(t, children.Things())
+
+	var disabled *ChildThings
+	disabled.ThingCreated("test:device:door")
+	disabled.ThingDeleted("test:device:door")
+}
+
+func TestKnownThings(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	children := NewChildThings(deviceID, &config.GatewaySettings{KnownChildThings: true}, watermill.NopLogger{})
+	children.ThingCreated("test:device:door")
+	h := knownThings(children, tracker, tracker.trackRequests(message.PassthroughHandler))
+
+	command := `{"topic":"test/%s/things/live/messages/open","headers":{"correlation-id":"%s"}}`
+	msgs, err := h(commandMessage("command//test:device/req/r1/open", fmt.Sprintf(command, "device", "c1")))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+	msgs, err = h(commandMessage("command//test:device:door/req/r2/open", fmt.Sprintf(command, "device:door", "c2")))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+
+	msgs, err = h(commandMessage("command//test:device:window/req/r3/open", fmt.Sprintf(command, "device:window", "c3")))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	assert.Equal(t, 2, tracker.Status().Pending)
+
+	responses := pub.published()
+	require.Equal(t, 1, len(responses))
+	assert.Equal(t, "command//test:device:window/res/r3/404", responses[0].topic)
+	assert.Contains(t, responses[0].payload, `"status":404`)
+	assert.Contains(t, responses[0].payload, `"error":"things:thing.notfound"`)
+
+	msgs, err = knownThings(nil, tracker, message.PassthroughHandler)(commandMessage("test", "not a command"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+}
+
+func TestChildThingNames(t *testing.T) {
+	settings := &config.GatewaySettings{
+		GatewayMode:            true,
+		ChildThingNameTemplate: "{deviceId}-{childId}",
+		ChildThingsFile:        t.TempDir() + "/things.json",
+	}
+	children := NewChildThings(deviceID, settings, watermill.NopLogger{})
+	children.ThingCreated("test:device:door")
+
+	assert.Equal(t, "test:device-door", children.ThingName("test:device:door"))
+	assert.Equal(t, deviceID, children.ThingName(deviceID))
+
+	thingID, ok := children.ThingID("test:device-door")
+	assert.True(t, ok)
+	assert.Equal(t, "test:device:door", thingID)
+	thingID, ok = children.ThingID(deviceID)
+	assert.True(t, ok)
+	assert.Equal(t, deviceID, thingID)
+	_, ok = children.ThingID("test:device-window")
+	assert.False(t, ok)
+
+	var disabled *ChildThings
+	_, ok = disabled.ThingID("test:device-door")
+	assert.False(t, ok)
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Types of the command audit records.
+const (
+	auditTypeCommand  = "command"
+	auditTypeRejected = "rejected"
+	auditTypeResponse = "response"
+)
+
+// CommandAudit records the cloud-to-device commands and their responses as JSON lines to an append-only audit file,
+// rotated by size.
+type CommandAudit struct {
+	out     io.WriteCloser
+	payload string
+	logger  watermill.LoggerAdapter
+
+	mutex sync.Mutex
+}
+
+// auditRecord represents a single line of the command audit file, the latency in milliseconds is set to the
+// responses of the tracked commands.
+type auditRecord struct {
+	Timestamp     string      `json:"timestamp"`
+	Type          string      `json:"type"`
+	CorrelationID string      `json:"correlation-id"`
+	Thing         string      `json:"thing"`
+	Feature       string      `json:"feature,omitempty"`
+	Subject       string      `json:"subject"`
+	Status        int         `json:"status,omitempty"`
+	Latency       *int64      `json:"latency,omitempty"`
+	PayloadHash   string      `json:"payloadHash,omitempty"`
+	Payload       interface{} `json:"payload,omitempty"`
+}
+
+// NewCommandAudit creates the command audit writing to the configured audit file, or nil if the audit file is not configured.
+func NewCommandAudit(settings *config.AuditSettings, logger watermill.LoggerAdapter) *CommandAudit {
+	if len(settings.AuditFile) == 0 {
+		return nil
+	}
+	out := &lumberjack.Logger{
+		Filename:   settings.AuditFile,
+		MaxSize:    settings.AuditFileSize,
+		MaxBackups: settings.AuditFileCount,
+		LocalTime:  true,
+	}
+	return newCommandAudit(out, settings.AuditPayload, logger)
+}
+
+func newCommandAudit(out io.WriteCloser, payload string, logger watermill.LoggerAdapter) *CommandAudit {
+	return &CommandAudit{
+		out:     out,
+		payload: payload,
+		logger:  logger,
+	}
+}
+
+// Close closes the audit file.
+func (a *CommandAudit) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.out.Close()
+}
+
+// request records the Ditto command forwarded to the local applications.
+func (a *CommandAudit) request(env *protocol.Envelope) {
+	if a == nil {
+		return
+	}
+	a.write(a.record(auditTypeCommand, env))
+}
+
+// rejected records the Ditto command rejected before its forwarding, along with the status of its error response.
+func (a *CommandAudit) rejected(env *protocol.Envelope, status int) {
+	if a == nil {
+		return
+	}
+	record := a.record(auditTypeRejected, env)
+	record.Status = status
+	a.write(record)
+}
+
+// response records the Ditto response of the command, the latency is set if the command is tracked.
+func (a *CommandAudit) response(env *protocol.Envelope, command *pendingCommand) {
+	if a == nil {
+		return
+	}
+	record := a.record(auditTypeResponse, env)
+	record.Status = env.Status
+	if record.Status == 0 {
+		record.Status = 200
+	}
+	if command != nil {
+		latency := time.Since(command.started).Milliseconds()
+		record.Latency = &latency
+	}
+	a.write(record)
+}
+
+func (a *CommandAudit) record(recordType string, env *protocol.Envelope) *auditRecord {
+	record := &auditRecord{
+		Timestamp:     time.Now().UTC().Format(time.RFC3339Nano),
+		Type:          recordType,
+		CorrelationID: env.Headers.CorrelationID(),
+		Feature:       featureID(env.Path),
+	}
+	if env.Topic != nil {
+		record.Thing = env.Topic.Namespace + ":" + env.Topic.EntityName
+		record.Subject = string(env.Topic.Action)
+	}
+	if env.Value == nil {
+		return record
+	}
+
+	switch a.payload {
+	case config.AuditPayloadFull:
+		record.Payload = env.Value
+	case config.AuditPayloadHash:
+		if data, err := json.Marshal(env.Value); err == nil {
+			sum := sha256.Sum256(data)
+			record.PayloadHash = hex.EncodeToString(sum[:])
+		}
+	}
+	return record
+}
+
+func (a *CommandAudit) write(record *auditRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		a.logger.Error("Cannot marshal command audit record", err, watermill.LogFields{"correlation-id": record.CorrelationID})
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, err := a.out.Write(append(data, '\n')); err != nil {
+		a.logger.Error("Cannot write command audit record", err, watermill.LogFields{"correlation-id": record.CorrelationID})
+	}
+}
+
+// auditRequests creates middleware handler which records the Ditto commands forwarded by the provided handler to the audit log.
+// It must wrap the command checks, so that only the commands passing them are recorded, the rejected ones are recorded on their rejection.
+func (t *CommandTracker) auditRequests(h message.HandlerFunc) message.HandlerFunc {
+	if t.audit == nil {
+		return h
+	}
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err != nil || len(msgs) == 0 {
+			return msgs, err
+		}
+
+		request := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if json.Unmarshal(msgs[0].Payload, request) == nil && request.Topic != nil {
+			t.audit.request(request)
+		}
+		return msgs, nil
+	}
+}
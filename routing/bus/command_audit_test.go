@@ -0,0 +1,200 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	closed bool
+}
+
+func (b *auditBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *auditBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *auditBuffer) records(t *testing.T) []map[string]interface{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buffer.String()), "\n") {
+		record := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCommandAudit(t *testing.T) {
+	out := &auditBuffer{}
+	audit := newCommandAudit(out, config.AuditPayloadNone, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, audit, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := tracker.auditRequests(newAwsCommandRequestHandler(tracker, nil, deviceID))
+	_, err := h(commandMessage(executionTopic, `{"feature":"door","subject":"open","value":{"angle":90}}`))
+	require.NoError(t, err)
+
+	responses := commandResponses(tracker, message.PassthroughHandler)
+	_, err = responses(commandMessage("command//test:device/res/e1/204", `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"e1"},"path":"/features/door/outbox/messages/open","status":204}`))
+	require.NoError(t, err)
+	require.NoError(t, audit.Close())
+	assert.True(t, out.closed)
+
+	records := out.records(t)
+	require.Equal(t, 2, len(records))
+
+	assert.Equal(t, "command", records[0]["type"])
+	assert.Equal(t, "e1", records[0]["correlation-id"])
+	assert.Equal(t, "test:device", records[0]["thing"])
+	assert.Equal(t, "door", records[0]["feature"])
+	assert.Equal(t, "open", records[0]["subject"])
+	assert.NotEmpty(t, records[0]["timestamp"])
+	assert.NotContains(t, records[0], "status")
+	assert.NotContains(t, records[0], "latency")
+	assert.NotContains(t, records[0], "payload")
+	assert.NotContains(t, records[0], "payloadHash")
+
+	assert.Equal(t, "response", records[1]["type"])
+	assert.Equal(t, "e1", records[1]["correlation-id"])
+	assert.Equal(t, "door", records[1]["feature"])
+	assert.Equal(t, float64(204), records[1]["status"])
+	assert.Contains(t, records[1], "latency")
+}
+
+func TestCommandAuditTimeout(t *testing.T) {
+	out := &auditBuffer{}
+	audit := newCommandAudit(out, config.AuditPayloadNone, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, audit, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := tracker.auditRequests(tracker.trackRequests(message.PassthroughHandler))
+	_, err := h(commandMessage("command//test:device/req/r1/open", `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"c1","timeout":"10ms"}}`))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return tracker.Status().TimedOut == 1
+	}, time.Second, 10*time.Millisecond)
+
+	records := out.records(t)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, "command", records[0]["type"])
+	assert.Equal(t, "response", records[1]["type"])
+	assert.Equal(t, "c1", records[1]["correlation-id"])
+	assert.Equal(t, float64(408), records[1]["status"])
+	assert.Contains(t, records[1], "latency")
+}
+
+func TestCommandAuditRejected(t *testing.T) {
+	out := &auditBuffer{}
+	audit := newCommandAudit(out, config.AuditPayloadNone, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, audit, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	policy := commandPolicy(t, `{"rules": [{"action": "allow", "subject": "^status$"}]}`)
+	h := tracker.auditRequests(authorize(policy, tracker, newAwsCommandRequestHandler(tracker, nil, deviceID)))
+	msgs, err := h(commandMessage(executionTopic, `{"feature":"door","subject":"open"}`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	records := out.records(t)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, "rejected", records[0]["type"])
+	assert.Equal(t, "e1", records[0]["correlation-id"])
+	assert.Equal(t, "open", records[0]["subject"])
+	assert.Equal(t, float64(403), records[0]["status"])
+	assert.Equal(t, "response", records[1]["type"])
+	assert.Equal(t, float64(403), records[1]["status"])
+}
+
+func TestCommandAuditPayload(t *testing.T) {
+	env := commandEnvelope(t, `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"c1"},"value":{"angle":90}}`)
+
+	full := &auditBuffer{}
+	newCommandAudit(full, config.AuditPayloadFull, watermill.NopLogger{}).request(env)
+	record := full.records(t)[0]
+	assert.Equal(t, map[string]interface{}{"angle": float64(90)}, record["payload"])
+	assert.NotContains(t, record, "payloadHash")
+
+	hash := &auditBuffer{}
+	newCommandAudit(hash, config.AuditPayloadHash, watermill.NopLogger{}).request(env)
+	record = hash.records(t)[0]
+	// sha256 of {"angle":90}
+	assert.Equal(t, "58b735bfe347231d85ad3888d29e538639b87ae14a6d93b75c72ab86db4b7eb5", record["payloadHash"])
+	assert.NotContains(t, record, "payload")
+}
+
+func TestNewCommandAudit(t *testing.T) {
+	var audit *CommandAudit
+	assert.NoError(t, audit.Close())
+	assert.Nil(t, NewCommandAudit(&config.AuditSettings{}, watermill.NopLogger{}))
+
+	file := t.TempDir() + "/audit.log"
+	audit = NewCommandAudit(&config.AuditSettings{
+		AuditFile:      file,
+		AuditFileSize:  1,
+		AuditFileCount: 1,
+		AuditPayload:   config.AuditPayloadNone,
+	}, watermill.NopLogger{})
+	require.NotNil(t, audit)
+	audit.request(commandEnvelope(t, `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"c1"}}`))
+	audit.request(commandEnvelope(t, `{"topic":"test/device/things/live/messages/close","headers":{"correlation-id":"c2"}}`))
+	require.NoError(t, audit.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"correlation-id":"c1"`)
+	assert.Contains(t, lines[1], `"correlation-id":"c2"`)
+}
+
+func commandEnvelope(t *testing.T, payload string) *protocol.Envelope {
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal([]byte(payload), env))
+	return env
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/pkg/errors"
+)
+
+// Minimum interval between the writes of the dedup file.
+const dedupSaveInterval = time.Second
+
+// CommandDedup drops the commands redelivered within the dedup window and re-sends the response of the original command
+// instead. The commands are identified by their correlation ID or AWS IoT command execution ID. The commands without
+// them are identified by the hash of their topic and payload, if enabled, otherwise they are not deduplicated.
+// The dedup window is persisted to the dedup file, if configured.
+type CommandDedup struct {
+	window    time.Duration
+	file      string
+	byPayload bool
+	pub       message.Publisher
+	logger    watermill.LoggerAdapter
+
+	mutex     sync.Mutex
+	entries   map[string]*dedupEntry
+	keys      map[string]string
+	saveTimer *time.Timer
+}
+
+// dedupEntry represents a command received within the dedup window along with its response, if already sent.
+type dedupEntry struct {
+	CorrelationID string         `json:"correlationId,omitempty"`
+	Expires       time.Time      `json:"expires"`
+	Response      *dedupResponse `json:"response,omitempty"`
+}
+
+// dedupResponse represents the response of a command as published toward AWS IoT.
+type dedupResponse struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// NewCommandDedup creates the command deduplication with the provided window, the duplicated command responses are re-sent
+// to the provided publisher. The commands received within the window before a restart are loaded from the dedup file.
+// If byPayload is true, the commands without correlation ID are identified by the hash of their topic and payload.
+func NewCommandDedup(window time.Duration,
+	file string,
+	byPayload bool,
+	pub message.Publisher,
+	logger watermill.LoggerAdapter,
+) *CommandDedup {
+	dedup := &CommandDedup{
+		window:    window,
+		file:      file,
+		byPayload: byPayload,
+		pub:       pub,
+		logger:    logger,
+		entries:   make(map[string]*dedupEntry),
+		keys:      make(map[string]string),
+	}
+	if err := dedup.load(); err != nil {
+		logger.Error("Cannot load command dedup file", err, watermill.LogFields{"file": file})
+	}
+	return dedup
+}
+
+// requests creates middleware handler which drops the duplicated commands before the provided handler.
+func (d *CommandDedup) requests(h message.HandlerFunc) message.HandlerFunc {
+	if d == nil {
+		return h
+	}
+	return func(msg *message.Message) ([]*message.Message, error) {
+		topic, _ := connector.TopicFromCtx(msg.Context())
+		key := dedupKey(topic, msg.Payload, d.byPayload)
+		if len(key) == 0 {
+			return h(msg)
+		}
+
+		if entry, ok := d.received(key); ok {
+			d.duplicate(key, entry)
+			return []*message.Message{}, nil
+		}
+
+		msgs, err := h(msg)
+		if err != nil || len(msgs) == 0 {
+			d.forget(key)
+			return msgs, err
+		}
+
+		command := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if json.Unmarshal(msgs[0].Payload, command) == nil {
+			d.forward(key, command.Headers.CorrelationID())
+		}
+		return msgs, nil
+	}
+}
+
+// response caches the response of the command published toward AWS IoT, if the command is within the dedup window.
+func (d *CommandDedup) response(correlationID, topic string, payload []byte) {
+	if d == nil || len(correlationID) == 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key, ok := d.keys[correlationID]
+	if !ok {
+		return
+	}
+	if entry, ok := d.entries[key]; ok && entry.Response == nil {
+		entry.Response = &dedupResponse{Topic: topic, Payload: payload}
+		d.changed()
+	}
+}
+
+// received returns the entry of the command if it is already received within the dedup window,
+// otherwise the command is added to the dedup window.
+func (d *CommandDedup) received(key string) (dedupEntry, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire(time.Now())
+	if entry, ok := d.entries[key]; ok {
+		return *entry, true
+	}
+	d.entries[key] = &dedupEntry{Expires: time.Now().Add(d.window)}
+	return dedupEntry{}, false
+}
+
+// forward records the correlation ID of the command forwarded to the local applications.
+func (d *CommandDedup) forward(key, correlationID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if entry, ok := d.entries[key]; ok {
+		entry.CorrelationID = correlationID
+		if len(correlationID) > 0 {
+			d.keys[correlationID] = key
+		}
+		d.changed()
+	}
+}
+
+// forget removes the command which was not forwarded from the dedup window, so that its redelivery is handled again.
+func (d *CommandDedup) forget(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.remove(key)
+}
+
+// duplicate re-sends the response of the original command, if the original command is already answered.
+func (d *CommandDedup) duplicate(key string, entry dedupEntry) {
+	fields := watermill.LogFields{"key": key, "correlation-id": entry.CorrelationID}
+	if entry.Response == nil {
+		d.logger.Debug("Duplicated command dropped, the original command is not answered yet", fields)
+		return
+	}
+
+	fields["topic"] = entry.Response.Topic
+	d.logger.Debug("Duplicated command dropped, re-sending the original response", fields)
+	if err := d.pub.Publish(entry.Response.Topic, message.NewMessage(watermill.NewUUID(), entry.Response.Payload)); err != nil {
+		d.logger.Error("Cannot re-send command response", err, fields)
+	}
+}
+
+// expire removes the commands received before the dedup window.
+func (d *CommandDedup) expire(now time.Time) {
+	for key, entry := range d.entries {
+		if now.After(entry.Expires) {
+			d.remove(key)
+		}
+	}
+}
+
+func (d *CommandDedup) remove(key string) {
+	if entry, ok := d.entries[key]; ok {
+		delete(d.keys, entry.CorrelationID)
+		delete(d.entries, key)
+	}
+}
+
+// load reads the commands within the dedup window from the dedup file.
+func (d *CommandDedup) load() error {
+	if len(d.file) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(d.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	entries := map[string]*dedupEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return errors.Wrap(err, "invalid command dedup file")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for key, entry := range entries {
+		d.entries[key] = entry
+		if len(entry.CorrelationID) > 0 {
+			d.keys[entry.CorrelationID] = key
+		}
+	}
+	d.expire(time.Now())
+	return nil
+}
+
+// Close writes the pending changes of the dedup window to the dedup file.
+func (d *CommandDedup) Close() {
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.saveTimer != nil && d.saveTimer.Stop() {
+		d.save()
+	}
+	d.saveTimer = nil
+}
+
+// changed schedules the write of the dedup file, at most once per save interval, so that the commands are not
+// delayed by the file writes. Must be called with the dedup mutex locked.
+func (d *CommandDedup) changed() {
+	if len(d.file) == 0 || d.saveTimer != nil {
+		return
+	}
+	d.saveTimer = time.AfterFunc(dedupSaveInterval, func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		d.saveTimer = nil
+		d.save()
+	})
+}
+
+// save writes the commands within the dedup window to the dedup file, the file is replaced atomically.
+func (d *CommandDedup) save() {
+	if len(d.file) == 0 {
+		return
+	}
+	if err := writeStateFile(d.file, d.entries); err != nil {
+		d.logger.Error("Cannot save command dedup file", err, watermill.LogFields{"file": d.file})
+	}
+}
+
+// dedupKey returns the correlation ID of the Ditto command or the execution ID of the AWS IoT command.
+// If they are missing, the hash of the topic and payload is returned if enabled, otherwise an empty string.
+func dedupKey(topic string, payload []byte, byPayload bool) string {
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	if json.Unmarshal(payload, env) == nil && env.Topic != nil {
+		if correlationID := env.Headers.CorrelationID(); len(correlationID) > 0 {
+			return correlationID
+		}
+	}
+	if execution, _, err := parseExecutionTopic(topic); err == nil {
+		return execution.executionID
+	}
+	if !byPayload {
+		return ""
+	}
+	hash := sha256.New()
+	hash.Write([]byte(topic))
+	hash.Write([]byte{0})
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeStateFile marshals the provided value to the state file, the file is written to a temporary file first and then renamed.
+func writeStateFile(file string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
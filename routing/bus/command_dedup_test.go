@@ -0,0 +1,194 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dedupCommand = `{"topic":"test/device/things/live/messages/dispense","headers":{"correlation-id":"c1","response-required":true}}`
+
+func TestCommandDedup(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	dedup := NewCommandDedup(time.Minute, "", false, pub, watermill.NopLogger{})
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, dedup, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := dedup.requests(tracker.trackRequests(routing.NewCommandRequestHandler(reqCache, "", deviceID, false)))
+	msgs, err := h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	// redelivered before the response
+	msgs, err = h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	assert.Equal(t, 0, len(pub.published()))
+
+	responses := commandResponses(tracker, routing.NewCommandResponseHandler(reqCache, "", "", deviceID, false))
+	response := `{"topic":"test/device/things/live/messages/dispense","headers":{"correlation-id":"c1"},"status":200}`
+	msgs, err = responses(commandMessage("command//test:device/res/r1/200", response))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device/res/r1/200")
+
+	// redelivered after the response
+	msgs, err = h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	resent := pub.published()
+	require.Equal(t, 1, len(resent))
+	assert.Equal(t, "command//test:device/res/r1/200", resent[0].topic)
+	assert.Equal(t, response, resent[0].payload)
+	assert.Equal(t, 0, tracker.Status().Pending)
+}
+
+func TestCommandDedupAwsCommands(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	dedup := NewCommandDedup(time.Minute, "", false, pub, watermill.NopLogger{})
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, dedup, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := dedup.requests(newAwsCommandRequestHandler(tracker, nil, deviceID))
+	msgs, err := h(commandMessage(executionTopic, `{"subject":"dispense"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	msgs, err = h(commandMessage(executionTopic, `{"subject":"dispense"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+
+	// same payload of another command execution
+	msgs, err = h(commandMessage("$aws/commands/things/test:device/executions/e2/request/json", `{"subject":"dispense"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	responses := commandResponses(tracker, message.PassthroughHandler)
+	_, err = responses(commandMessage("command//test:device/res/e1/200", `{"topic":"test/device/things/live/messages/dispense","headers":{"correlation-id":"e1"},"status":200}`))
+	require.NoError(t, err)
+
+	msgs, err = h(commandMessage(executionTopic, `{"subject":"dispense"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	resent := pub.published()
+	require.Equal(t, 1, len(resent))
+	assert.Equal(t, "$aws/commands/things/test:device/executions/e1/response/json", resent[0].topic)
+	assert.Contains(t, resent[0].payload, `"status":"SUCCEEDED"`)
+}
+
+func TestCommandDedupWindow(t *testing.T) {
+	dedup := NewCommandDedup(10*time.Millisecond, "", false, &topicPublisher{}, watermill.NopLogger{})
+	h := dedup.requests(message.PassthroughHandler)
+
+	msgs, err := h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+
+	time.Sleep(20 * time.Millisecond)
+	msgs, err = h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+}
+
+func TestCommandDedupNotForwarded(t *testing.T) {
+	dedup := NewCommandDedup(time.Minute, "", false, &topicPublisher{}, watermill.NopLogger{})
+
+	failing := dedup.requests(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.New("not forwarded")
+	})
+	_, err := failing(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	assert.Error(t, err)
+
+	h := dedup.requests(message.PassthroughHandler)
+	msgs, err := h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+}
+
+func TestCommandDedupPersistence(t *testing.T) {
+	file := t.TempDir() + "/state/dedup.json"
+	dedup := NewCommandDedup(time.Minute, file, false, &topicPublisher{}, watermill.NopLogger{})
+	h := dedup.requests(message.PassthroughHandler)
+	_, err := h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	dedup.response("c1", "command//test:device/res/r1/200", []byte(`{"status":200}`))
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	dedup.Close()
+	_, err = os.Stat(file)
+	require.NoError(t, err)
+
+	// restarted
+	pub := &topicPublisher{}
+	dedup = NewCommandDedup(time.Minute, file, false, pub, watermill.NopLogger{})
+	h = dedup.requests(message.PassthroughHandler)
+	msgs, err := h(commandMessage("command//test:device/req/r1/dispense", dedupCommand))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	resent := pub.published()
+	require.Equal(t, 1, len(resent))
+	assert.Equal(t, published{topic: "command//test:device/res/r1/200", payload: `{"status":200}`}, resent[0])
+
+	require.NoError(t, os.WriteFile(file, []byte("invalid"), 0600))
+	dedup = NewCommandDedup(time.Minute, file, false, pub, watermill.NopLogger{})
+	assert.Equal(t, 0, len(dedup.entries))
+}
+
+func TestCommandDedupByPayload(t *testing.T) {
+	command := `{"subject":"dispense"}`
+
+	dedup := NewCommandDedup(time.Minute, "", false, &topicPublisher{}, watermill.NopLogger{})
+	h := dedup.requests(message.PassthroughHandler)
+	for i := 0; i < 2; i++ {
+		msgs, err := h(commandMessage("devices/dispenser/commands", command))
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(msgs))
+	}
+	assert.Empty(t, dedup.entries)
+
+	dedup = NewCommandDedup(time.Minute, "", true, &topicPublisher{}, watermill.NopLogger{})
+	h = dedup.requests(message.PassthroughHandler)
+	msgs, err := h(commandMessage("devices/dispenser/commands", command))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+	msgs, err = h(commandMessage("devices/dispenser/commands", command))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+}
+
+func TestDedupKey(t *testing.T) {
+	assert.Equal(t, "c1", dedupKey("command//test:device/req/r1/dispense", []byte(dedupCommand), false))
+	assert.Equal(t, "e1", dedupKey(executionTopic, []byte(`{"subject":"dispense"}`), true))
+
+	noCorrelationID := []byte(`{"topic":"test/device/things/live/messages/dispense"}`)
+	assert.Empty(t, dedupKey("command//test:device/req/r1/dispense", noCorrelationID, false))
+	key := dedupKey("command//test:device/req/r1/dispense", noCorrelationID, true)
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, dedupKey("command//test:device/req/r1/dispense", noCorrelationID, true))
+	assert.NotEqual(t, key, dedupKey("command//test:device/req/r2/dispense", noCorrelationID, true))
+	assert.NotEqual(t, key, dedupKey("command//test:device/req/r1/dispense", []byte(`{"subject":"dispense"}`), true))
+}
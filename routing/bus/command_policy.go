@@ -0,0 +1,87 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// Ditto error code of the commands rejected by the command policy.
+const errorCodeForbidden = "messages:send.notallowed"
+
+// authorize creates middleware handler which evaluates the command policy against the Ditto commands forwarded by the provided handler.
+// The rejected commands are not forwarded, they are logged and responded with a Ditto 403 error toward AWS IoT.
+func authorize(policy *config.CommandPolicy, tracker *CommandTracker, h message.HandlerFunc) message.HandlerFunc {
+	if policy == nil {
+		return h
+	}
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err != nil || len(msgs) == 0 {
+			return msgs, err
+		}
+
+		request := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if err := json.Unmarshal(msgs[0].Payload, request); err != nil || request.Topic == nil {
+			tracker.logger.Info("Command rejected by policy, not a Ditto message", nil)
+			return []*message.Message{}, nil
+		}
+
+		thing := fmt.Sprintf("%s:%s", request.Topic.Namespace, request.Topic.EntityName)
+		feature := featureID(request.Path)
+		subject := string(request.Topic.Action)
+		sender := ""
+		if value, ok := request.Headers.Values[policy.SenderHeader]; ok && value != nil {
+			sender = fmt.Sprint(value)
+		}
+
+		allowed, rule := policy.Allows(thing, feature, subject, sender)
+		if allowed {
+			return msgs, nil
+		}
+
+		fields := watermill.LogFields{
+			"correlation-id": request.Headers.CorrelationID(),
+			"thing":          thing,
+			"feature":        feature,
+			"subject":        subject,
+			"sender":         sender,
+		}
+		if rule != nil {
+			fields["rule"] = fmt.Sprintf("thing=%q feature=%q subject=%q sender=%q", rule.Thing, rule.Feature, rule.Subject, rule.Sender)
+		}
+		tracker.logger.Info("Command rejected by policy", fields)
+
+		description := fmt.Sprintf("The command '%s' is not allowed on thing '%s'.", subject, thing)
+		tracker.reject(request, http.StatusForbidden, errorCodeForbidden, description)
+		return []*message.Message{}, nil
+	}
+}
+
+// featureID returns the feature ID of the Ditto path in format /features/<featureId>/..., or empty string for thing paths.
+func featureID(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > 1 && segments[0] == "features" {
+		return segments[1]
+	}
+	return ""
+}
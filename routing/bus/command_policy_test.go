@@ -0,0 +1,110 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	policy := commandPolicy(t, `{
+		"senderHeader": "x-sender",
+		"rules": [
+			{"action": "deny", "feature": "^door$", "subject": "^open$", "sender": "^guest$"},
+			{"action": "allow", "thing": "^test:device(:.+)?$"}
+		]
+	}`)
+	h := filter(deviceID, authorize(policy, tracker, tracker.trackRequests(message.PassthroughHandler)))
+
+	open := `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"%s","x-sender":"%s"},"path":"/features/door/inbox/messages/open"}`
+	msgs, err := h(commandMessage("command//test:device/req/r1/open", fmt.Sprintf(open, "c1", "admin")))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, 1, tracker.Status().Pending)
+
+	msgs, err = h(commandMessage("command//test:device/req/r2/open", fmt.Sprintf(open, "c2", "guest")))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+	assert.Equal(t, 1, tracker.Status().Pending)
+	_, ok := reqCache.Get("c2")
+	assert.False(t, ok)
+
+	responses := pub.published()
+	require.Equal(t, 1, len(responses))
+	assert.Equal(t, "command//test:device/res/r2/403", responses[0].topic)
+	assert.Contains(t, responses[0].payload, `"status":403`)
+	assert.Contains(t, responses[0].payload, `"correlation-id":"c2"`)
+	assert.Contains(t, responses[0].payload, `"error":"messages:send.notallowed"`)
+}
+
+func TestAuthorizeDefault(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	policy := commandPolicy(t, `{"rules": [{"action": "allow", "subject": "^status$"}]}`)
+	h := authorize(policy, tracker, newAwsCommandRequestHandler(tracker, nil, deviceID))
+
+	msgs, err := h(commandMessage(executionTopic, `{"subject":"status"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	msgs, err = h(commandMessage("$aws/commands/things/test:device/executions/e2/request", `{"subject":"reboot"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(msgs))
+
+	responses := pub.published()
+	require.Equal(t, 1, len(responses))
+	assert.Equal(t, "$aws/commands/things/test:device/executions/e2/response/json", responses[0].topic)
+	assert.Contains(t, responses[0].payload, `"status":"FAILED"`)
+	assert.Contains(t, responses[0].payload, `"reasonCode":"403"`)
+}
+
+func TestAuthorizeWithoutPolicy(t *testing.T) {
+	h := authorize(nil, nil, message.PassthroughHandler)
+	msgs, err := h(message.NewMessage("test", []byte("not a command")))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(msgs))
+}
+
+func TestFeatureID(t *testing.T) {
+	assert.Equal(t, "door", featureID("/features/door/inbox/messages/open"))
+	assert.Equal(t, "", featureID("/inbox/messages/open"))
+	assert.Equal(t, "", featureID("/features"))
+}
+
+func commandPolicy(t *testing.T, policy string) *config.CommandPolicy {
+	file := t.TempDir() + "/policy.json"
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0600))
+	loaded, err := config.LoadCommandPolicy(file)
+	require.NoError(t, err)
+	return loaded
+}
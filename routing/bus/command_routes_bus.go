@@ -0,0 +1,177 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/pkg/errors"
+)
+
+const commandRoutesHandlerName = "command_routes_handler"
+
+// commandReply represents a routed command waiting for its Ditto response.
+type commandReply struct {
+	topic  string
+	format string
+	values map[string]string
+}
+
+// CommandRoutesBus creates the bus of the commands received on the AWS IoT topics of the command routes.
+// The commands are converted to Ditto live messages, the commands with reply topic are tracked until their response.
+func CommandRoutesBus(router *message.Router,
+	pub message.Publisher,
+	sub message.Subscriber,
+	tracker *CommandTracker,
+	policy *config.CommandPolicy,
+	children *ChildThings,
+	deviceID string,
+	routes []config.CommandRoute,
+) *message.Handler {
+	filters := []string{}
+	for i := range routes {
+		if filter := routes[i].Filter(); !contains(filters, filter) {
+			filters = append(filters, filter)
+		}
+	}
+	handler := tracker.dedup.requests(tracker.auditRequests(authorize(policy, tracker, knownThings(children, tracker, newCommandRoutesHandler(tracker, deviceID, routes)))))
+	return router.AddHandler(commandRoutesHandlerName, strings.Join(filters, ","), sub, connector.TopicEmpty, pub, handler)
+}
+
+// newCommandRoutesHandler returns the handler function converting the commands of the first matching route to Ditto live messages.
+func newCommandRoutesHandler(tracker *CommandTracker, deviceID string, routes []config.CommandRoute) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		topic, ok := connector.TopicFromCtx(msg.Context())
+		if !ok {
+			return nil, errors.New("no topic in context")
+		}
+
+		for i := range routes {
+			route := &routes[i]
+			if values, ok := route.Values(topic); ok {
+				return routeCommand(tracker, deviceID, route, values, msg.Payload)
+			}
+		}
+		return nil, errors.Errorf("no command route for topic '%s'", topic)
+	}
+}
+
+// routeCommand converts the command payload to a Ditto live message using the command route templates.
+func routeCommand(tracker *CommandTracker,
+	deviceID string,
+	route *config.CommandRoute,
+	values map[string]string,
+	payload []byte,
+) ([]*message.Message, error) {
+	values[config.PlaceholderDeviceID] = deviceID
+	if len(values[config.PlaceholderCorrelationID]) == 0 {
+		values[config.PlaceholderCorrelationID] = watermill.NewUUID()
+	}
+	correlationID := values[config.PlaceholderCorrelationID]
+
+	command := &liveCommand{
+		ThingID: config.ExpandTemplate(route.ThingID, values),
+		Feature: config.ExpandTemplate(route.Feature, values),
+		Subject: config.ExpandTemplate(route.Subject, values),
+		Timeout: route.Timeout,
+	}
+	if route.Value == nil {
+		command.Value = payloadValue(payload)
+	} else {
+		values[config.PlaceholderPayload] = string(payload)
+		command.Value = expandValue(route.Value, values, payloadValue(payload))
+	}
+
+	responseRequired := len(route.ReplyTopic) > 0
+	timeout, err := tracker.commandTimeout(route.Timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid command for route '%s'", route.Topic)
+	}
+	result, request, err := toCommandMessages(command, correlationID, deviceID, timeout, responseRequired)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid command for route '%s'", route.Topic)
+	}
+	if responseRequired {
+		tracker.put(request, timeout, &commandReply{topic: route.ReplyTopic, format: route.ReplyFormat, values: values})
+	}
+	return result, nil
+}
+
+// response publishes the Ditto response, or only its value, to the expanded reply topic.
+func (reply *commandReply) response(env *protocol.Envelope, payload []byte) (string, []byte, error) {
+	reply.values[config.PlaceholderStatus] = fmt.Sprint(env.Status)
+	topic := config.ExpandTopicTemplate(reply.topic, reply.values)
+	if reply.format != config.OutputFormatValue {
+		return topic, payload, nil
+	}
+	data, err := json.Marshal(env.Value)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "cannot marshal command response value")
+	}
+	return topic, data, nil
+}
+
+// payloadValue returns the JSON value of the payload, or the payload as string if it is not a JSON value.
+func payloadValue(payload []byte) interface{} {
+	if len(payload) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return string(payload)
+	}
+	return value
+}
+
+// expandValue returns a copy of the payload template with expanded string values.
+// A string consisting of the {payload} placeholder only is replaced with the payload value.
+func expandValue(template interface{}, values map[string]string, payload interface{}) interface{} {
+	switch v := template.(type) {
+	case string:
+		if v == "{"+config.PlaceholderPayload+"}" {
+			return payload
+		}
+		return config.ExpandTemplate(v, values)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = expandValue(item, values, payload)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = expandValue(item, values, payload)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
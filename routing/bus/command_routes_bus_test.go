@@ -0,0 +1,163 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	test "github.com/eclipse-kanto/aws-connector/routing/bus/internal/testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandRoutesBus(t *testing.T) {
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	routes := commandRoutes(t,
+		config.CommandRoute{Topic: "cmd/{site}/{thing}/{feature}/{operation}", Subject: "{operation}"},
+		config.CommandRoute{Topic: "cmd/{area}/{device}/{part}/{action}", Subject: "{action}"},
+		config.CommandRoute{Topic: "ops/+/reboot/#", Subject: "reboot"},
+	)
+	CommandRoutesBus(router, connector.NullPublisher(), test.NewDummySubscriber(), tracker, nil, nil, deviceID, routes)
+	refRouter := reflect.Indirect(reflect.ValueOf(router))
+	refHandlers := refRouter.FieldByName(fieldHandlers)
+	assert.Equal(t, 1, refHandlers.Len())
+	refHandler := refHandlers.MapIndex(refHandlers.MapKeys()[0])
+	test.AssertRouterHandler(t, commandRoutesHandlerName, "cmd/+/+/+/+,ops/+/reboot/#", "", reflect.Indirect(refHandler))
+}
+
+func TestCommandRoute(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	routes := commandRoutes(t, config.CommandRoute{
+		Topic:       "cmd/{site}/{thing}/{feature}/{operation}",
+		ThingID:     "{deviceId}:{thing}",
+		Feature:     "{feature}",
+		Subject:     "{operation}",
+		Value:       map[string]interface{}{"site": "{site}", "args": "{payload}"},
+		Timeout:     "5s",
+		ReplyTopic:  "reply/{site}/{thing}/{operation}/{status}",
+		ReplyFormat: config.OutputFormatValue,
+	})
+	h := newCommandRoutesHandler(tracker, deviceID, routes)
+
+	msgs, err := h(commandMessage("cmd/plant1/dispenser/tank/dispense", `{"amount":2}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device:dispenser/req/"+correlationID(t, msgs[0])+"/dispense")
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, env))
+	assert.Equal(t, "test/device:dispenser/things/live/messages/dispense", env.Topic.String())
+	assert.Equal(t, "/features/tank/inbox/messages/dispense", env.Path)
+	assert.Equal(t, map[string]interface{}{"site": "plant1", "args": map[string]interface{}{"amount": float64(2)}}, env.Value)
+	assert.Equal(t, "5s", env.Headers.Timeout())
+	assert.True(t, env.Headers.IsResponseRequired())
+
+	responses := commandResponses(tracker, message.PassthroughHandler)
+	response := `{"topic":"test/device:dispenser/things/live/messages/dispense","headers":{"correlation-id":"` +
+		env.Headers.CorrelationID() + `"},"status":200,"value":{"dispensed":2}}`
+	msgs, err = responses(commandMessage("command//test:device:dispenser/res/id/200", response))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assertMessageTopic(t, msgs[0], "reply/plant1/dispenser/dispense/200")
+	assert.Equal(t, `{"dispensed":2}`, string(msgs[0].Payload))
+	assert.Equal(t, 0, reqCache.Size())
+}
+
+func TestCommandRouteDefaults(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	routes := commandRoutes(t, config.CommandRoute{
+		Topic:      "ops/{correlationId}/{subject}",
+		Subject:    "{subject}",
+		ReplyTopic: "ops/{correlationId}/reply",
+	})
+	h := newCommandRoutesHandler(tracker, deviceID, routes)
+
+	msgs, err := h(commandMessage("ops/c1/reboot", `plain text`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device/req/c1/reboot")
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, env))
+	assert.Equal(t, "/inbox/messages/reboot", env.Path)
+	assert.Equal(t, "plain text", env.Value)
+
+	response := `{"topic":"test/device/things/live/messages/reboot","headers":{"correlation-id":"c1"},"status":204}`
+	msgs, err = commandResponses(tracker, message.PassthroughHandler)(commandMessage("command//test:device/res/c1/204", response))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assertMessageTopic(t, msgs[0], "ops/c1/reply")
+	assert.Equal(t, response, string(msgs[0].Payload))
+}
+
+func TestCommandRouteWithoutReply(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	routes := commandRoutes(t, config.CommandRoute{Topic: "ops/{subject}", Subject: "{subject}"})
+	h := newCommandRoutesHandler(tracker, deviceID, routes)
+
+	msgs, err := h(commandMessage("ops/reboot", `{}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, env))
+	assert.False(t, env.Headers.IsResponseRequired())
+	assert.Equal(t, 0, reqCache.Size())
+
+	_, err = h(commandMessage("ops/reboot/now", `{}`))
+	assert.Error(t, err)
+
+	routes = commandRoutes(t, config.CommandRoute{Topic: "ops/{thing}/{subject}", ThingID: "{thing}", Subject: "{subject}"})
+	_, err = newCommandRoutesHandler(tracker, deviceID, routes)(commandMessage("ops/other:thing/reboot", `{}`))
+	assert.Error(t, err)
+}
+
+func commandRoutes(t *testing.T, routes ...config.CommandRoute) []config.CommandRoute {
+	settings := &config.CloudSettings{}
+	settings.CommandRoutes = routes
+	require.NoError(t, settings.CompileFilters())
+	require.NoError(t, settings.CommandSettings.Validate())
+	return settings.CommandRoutes
+}
+
+func correlationID(t *testing.T, msg *message.Message) string {
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	require.NoError(t, json.Unmarshal(msg.Payload, env))
+	return env.Headers.CorrelationID()
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse-kanto/suite-connector/util"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+const (
+	// TopicCommandsStatus defines the commands status message topic.
+	TopicCommandsStatus = "edge/connection/remote/commands/status"
+
+	// Ditto error code of the commands not answered within their timeout.
+	errorCodeTimeout = "messages:message.timeout"
+
+	// Response topic of the command requests, in format command//<thingId>/res/<reqId>/<status>.
+	topicCommandResponse = "command//%s/res/%s/%d"
+
+	// Minimum interval between the commands status messages published on the pending commands change.
+	commandsStatusInterval = time.Second
+)
+
+// CommandsStatus contains the number of pending and timed out commands.
+type CommandsStatus struct {
+	Pending   int    `json:"pending"`
+	TimedOut  uint64 `json:"timedOut"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// CommandTracker keeps the commands forwarded to the local applications until their response.
+// The commands which are not answered within their timeout are responded with a Ditto 408 error toward AWS IoT.
+type CommandTracker struct {
+	reqCache  *cache.Cache
+	pub       message.Publisher
+	statusPub message.Publisher
+	timeout   time.Duration
+	audit     *CommandAudit
+	dedup     *CommandDedup
+	logger    watermill.LoggerAdapter
+
+	mutex       sync.Mutex
+	pending     map[string]*pendingCommand
+	timedOut    uint64
+	statusTimer *time.Timer
+	closed      bool
+}
+
+// pendingCommand represents a tracked command waiting for its response.
+type pendingCommand struct {
+	timer     *time.Timer
+	request   *protocol.Envelope
+	responder commandResponder
+	started   time.Time
+}
+
+// honoCommand represents a command received on the command//+/req/# topics.
+type honoCommand struct {
+	thingID string
+	reqID   string
+}
+
+// NewCommandTracker creates a command tracker publishing the timeout responses to the provided publisher
+// and the commands status to the status publisher. The default timeout applies to the commands without
+// Ditto timeout header, the Ditto default of 60 seconds is used if it is not positive.
+// The commands and their responses are recorded to the command audit and the command dedup window, if not nil.
+// The initial commands status is published shortly after the tracker creation.
+func NewCommandTracker(reqCache *cache.Cache,
+	pub message.Publisher,
+	statusPub message.Publisher,
+	defaultTimeout time.Duration,
+	audit *CommandAudit,
+	dedup *CommandDedup,
+	logger watermill.LoggerAdapter,
+) *CommandTracker {
+	if defaultTimeout <= 0 {
+		defaultTimeout = util.ParseTimeout("")
+	}
+	tracker := &CommandTracker{
+		reqCache:  reqCache,
+		pub:       pub,
+		statusPub: statusPub,
+		timeout:   defaultTimeout,
+		audit:     audit,
+		dedup:     dedup,
+		logger:    logger,
+		pending:   make(map[string]*pendingCommand),
+	}
+	tracker.statusChanged()
+	return tracker
+}
+
+// Status returns the number of pending commands and the number of timed out commands since the tracker creation.
+func (t *CommandTracker) Status() CommandsStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return CommandsStatus{
+		Pending:   len(t.pending),
+		TimedOut:  atomic.LoadUint64(&t.timedOut),
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// Close stops the timers of all pending commands and the commands status publishing.
+func (t *CommandTracker) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.closed = true
+	if t.statusTimer != nil {
+		t.statusTimer.Stop()
+		t.statusTimer = nil
+	}
+	for correlationID, command := range t.pending {
+		command.timer.Stop()
+		delete(t.pending, correlationID)
+	}
+}
+
+// commandTimeout returns the duration of the Ditto timeout header, or the default timeout if the header is missing.
+func (t *CommandTracker) commandTimeout(header string) (time.Duration, error) {
+	if len(header) == 0 {
+		return t.timeout, nil
+	}
+	return config.ParseCommandTimeout(header)
+}
+
+// put caches the command until its response and starts its timeout, commands with zero timeout are not answered.
+func (t *CommandTracker) put(request *protocol.Envelope, timeout time.Duration, responder commandResponder) {
+	if timeout <= 0 {
+		return
+	}
+	correlationID := request.Headers.CorrelationID()
+	t.reqCache.Put(correlationID, responder, timeout+executionGracePeriod)
+	t.track(request, timeout, responder)
+}
+
+// track starts the timeout of the command, the responder is used to publish the timeout response.
+func (t *CommandTracker) track(request *protocol.Envelope, timeout time.Duration, responder commandResponder) {
+	correlationID := request.Headers.CorrelationID()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if command, ok := t.pending[correlationID]; ok {
+		command.timer.Stop()
+	}
+	t.pending[correlationID] = &pendingCommand{
+		timer: time.AfterFunc(timeout, func() {
+			t.expire(correlationID)
+		}),
+		request:   request,
+		responder: responder,
+		started:   time.Now(),
+	}
+	t.statusChanged()
+}
+
+// done stops the timeout of the answered command and returns it, if it is still pending.
+func (t *CommandTracker) done(correlationID string) (*pendingCommand, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	command, ok := t.pending[correlationID]
+	if ok {
+		command.timer.Stop()
+		delete(t.pending, correlationID)
+		t.statusChanged()
+	}
+	return command, ok
+}
+
+// trackRequests creates middleware handler which tracks the timeouts of the command requests handled by the provided handler.
+func (t *CommandTracker) trackRequests(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err != nil || len(msgs) == 0 {
+			return msgs, err
+		}
+
+		topic, _ := connector.TopicFromCtx(msg.Context())
+		request := &protocol.Envelope{Headers: protocol.NewHeaders()}
+		if json.Unmarshal(msg.Payload, request) != nil || request.Topic == nil {
+			return msgs, nil
+		}
+		if correlationID := request.Headers.CorrelationID(); len(correlationID) > 0 {
+			command := &honoCommand{
+				thingID: fmt.Sprintf("%s:%s", request.Topic.Namespace, request.Topic.EntityName),
+			}
+			// command//<deviceId>/req/<reqId>/<subject> or cmd//<deviceId>/q/<reqId>/<subject>
+			if segments := strings.Split(topic, "/"); len(segments) > 4 {
+				command.reqID = segments[4]
+			}
+			timeout, err := t.commandTimeout(request.Headers.Timeout())
+			if err != nil {
+				// The Ditto command is forwarded unchanged, it is tracked with the default timeout if its header is invalid.
+				timeout = t.timeout
+			}
+			if timeout > 0 {
+				t.reqCache.Put(correlationID, true, timeout+executionGracePeriod)
+				t.track(request, timeout, command)
+			}
+		}
+		return msgs, nil
+	}
+}
+
+// expire publishes the Ditto 408 error response of the command if it is still not answered.
+func (t *CommandTracker) expire(correlationID string) {
+	command, ok := t.done(correlationID)
+	if !ok || !t.reqCache.Remove(correlationID) {
+		return
+	}
+
+	description := fmt.Sprintf("The command '%s' was not answered within its timeout.", command.request.Topic.Action)
+	if !t.respond(command, errorResponse(command.request, http.StatusRequestTimeout, errorCodeTimeout, description)) {
+		return
+	}
+
+	timedOut := atomic.AddUint64(&t.timedOut, 1)
+	t.logger.Info("Command timed out", watermill.LogFields{
+		"correlation-id":  correlationID,
+		"topic":           command.request.Topic.String(),
+		"timed_out_total": timedOut,
+	})
+	t.sendStatus()
+}
+
+// reject records the rejected command to the command audit and publishes its Ditto error response, if it is tracked.
+func (t *CommandTracker) reject(request *protocol.Envelope, status int, errorCode, description string) {
+	t.audit.rejected(request, status)
+	correlationID := request.Headers.CorrelationID()
+	command, ok := t.done(correlationID)
+	if !ok {
+		return
+	}
+	t.reqCache.Remove(correlationID)
+	t.respond(command, errorResponse(request, status, errorCode, description))
+}
+
+// respond publishes the response of the command toward AWS IoT using the command responder.
+func (t *CommandTracker) respond(command *pendingCommand, response *protocol.Envelope) bool {
+	correlationID := response.Headers.CorrelationID()
+	payload, err := json.Marshal(response)
+	if err != nil {
+		t.logger.Error("Cannot marshal command response", err, watermill.LogFields{"correlation-id": correlationID})
+		return false
+	}
+	topic, payload, err := command.responder.response(response, payload)
+	if err != nil {
+		t.logger.Error("Cannot create command response", err, watermill.LogFields{"correlation-id": correlationID})
+		return false
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	if err := t.pub.Publish(topic, msg); err != nil {
+		t.logger.Error("Cannot publish command response", err, watermill.LogFields{"topic": topic})
+		return false
+	}
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), topic))
+	t.responded(response, command, msg)
+	return true
+}
+
+// responded records the response of the command published toward AWS IoT to the command audit and dedup window.
+func (t *CommandTracker) responded(env *protocol.Envelope, command *pendingCommand, response *message.Message) {
+	t.audit.response(env, command)
+	topic, _ := connector.TopicFromCtx(response.Context())
+	t.dedup.response(env.Headers.CorrelationID(), topic, response.Payload)
+}
+
+// statusChanged schedules the commands status publishing, at most once per status interval.
+// Must be called with the tracker mutex locked.
+func (t *CommandTracker) statusChanged() {
+	if t.statusPub == nil || t.closed || t.statusTimer != nil {
+		return
+	}
+	t.statusTimer = time.AfterFunc(commandsStatusInterval, func() {
+		t.mutex.Lock()
+		closed := t.closed
+		t.statusTimer = nil
+		t.mutex.Unlock()
+
+		if !closed {
+			t.sendStatus()
+		}
+	})
+}
+
+// sendStatus publishes the commands status as retained message.
+func (t *CommandTracker) sendStatus() {
+	if t.statusPub == nil {
+		return
+	}
+	payload, err := json.Marshal(t.Status())
+	if err != nil {
+		return
+	}
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.SetContext(connector.SetRetainToCtx(msg.Context(), true))
+	if err := t.statusPub.Publish(TopicCommandsStatus, msg); err != nil {
+		t.logger.Error("Cannot publish commands status", err, nil)
+	}
+}
+
+// response publishes the Ditto response to the command response topic.
+func (command *honoCommand) response(env *protocol.Envelope, payload []byte) (string, []byte, error) {
+	return fmt.Sprintf(topicCommandResponse, command.thingID, command.reqID, env.Status), payload, nil
+}
+
+// errorResponse returns the Ditto error response of the command request.
+func errorResponse(request *protocol.Envelope, status int, errorCode, description string) *protocol.Envelope {
+	headers := protocol.NewHeaders(
+		protocol.WithCorrelationID(request.Headers.CorrelationID()),
+		protocol.WithContentType(contentTypeJSON),
+	)
+	value := map[string]interface{}{
+		"status":  status,
+		"error":   errorCode,
+		"message": description,
+	}
+	return (&protocol.Envelope{}).
+		WithTopic(request.Topic).
+		WithHeaders(headers).
+		WithPath(request.Path).
+		WithStatus(status).
+		WithValue(value)
+}
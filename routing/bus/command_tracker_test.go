@@ -0,0 +1,191 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/cache"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type published struct {
+	topic   string
+	payload string
+}
+
+type topicPublisher struct {
+	mutex    sync.Mutex
+	messages []published
+}
+
+func (p *topicPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, msg := range messages {
+		p.messages = append(p.messages, published{topic: topic, payload: string(msg.Payload)})
+	}
+	return nil
+}
+
+func (p *topicPublisher) Close() error { return nil }
+
+func (p *topicPublisher) published() []published {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]published{}, p.messages...)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub, statusPub := &topicPublisher{}, &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, statusPub, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := filter(deviceID, tracker.trackRequests(message.PassthroughHandler))
+	payload := `{"topic":"test/device/things/live/messages/install","headers":{"correlation-id":"c1","timeout":"100ms"},"path":"/inbox/messages/install"}`
+	msgs, err := h(commandMessage("command//test:device/req/r1/install", payload))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assert.Equal(t, 1, tracker.Status().Pending)
+
+	require.Eventually(t, func() bool { return len(pub.published()) == 1 }, time.Second, 10*time.Millisecond)
+	response := pub.published()[0]
+	assert.Equal(t, "command//test:device/res/r1/408", response.topic)
+	assert.Contains(t, response.payload, `"status":408`)
+	assert.Contains(t, response.payload, `"correlation-id":"c1"`)
+	assert.Contains(t, response.payload, `"error":"messages:message.timeout"`)
+
+	status := tracker.Status()
+	assert.Equal(t, 0, status.Pending)
+	assert.Equal(t, uint64(1), status.TimedOut)
+
+	require.Equal(t, 1, len(statusPub.published()))
+	assert.Equal(t, TopicCommandsStatus, statusPub.published()[0].topic)
+	sent := &CommandsStatus{}
+	require.NoError(t, json.Unmarshal([]byte(statusPub.published()[0].payload), sent))
+	assert.Equal(t, uint64(1), sent.TimedOut)
+	_, ok := reqCache.Get("c1")
+	assert.False(t, ok)
+}
+
+func TestCommandsStatus(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	statusPub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), statusPub, time.Minute, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	assertStatus := func(count, pending int) {
+		require.Eventually(t, func() bool { return len(statusPub.published()) == count }, 3*time.Second, 10*time.Millisecond)
+		sent := &CommandsStatus{}
+		require.NoError(t, json.Unmarshal([]byte(statusPub.published()[count-1].payload), sent))
+		assert.Equal(t, pending, sent.Pending)
+	}
+	assertStatus(1, 0)
+
+	h := filter(deviceID, tracker.trackRequests(message.PassthroughHandler))
+	payload := `{"topic":"test/device/things/live/messages/install","headers":{"correlation-id":"c1"},"path":"/inbox/messages/install"}`
+	_, err := h(commandMessage("command//test:device/req/r1/install", payload))
+	require.NoError(t, err)
+	assertStatus(2, 1)
+
+	tracker.done("c1")
+	assertStatus(3, 0)
+
+	tracker.Close()
+	tracker.track(&protocol.Envelope{Headers: protocol.NewHeaders(protocol.WithCorrelationID("c2"))}, time.Minute, nil)
+	time.Sleep(2 * commandsStatusInterval)
+	assert.Equal(t, 3, len(statusPub.published()))
+}
+
+func TestCommandAnsweredBeforeTimeout(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 100*time.Millisecond, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	h := newAwsCommandRequestHandler(tracker, nil, deviceID)
+	msgs, err := h(commandMessage(executionTopic, `{"subject":"open"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assert.Equal(t, 1, tracker.Status().Pending)
+
+	responses := commandResponses(tracker, message.PassthroughHandler)
+	msgs, err = responses(commandMessage("command//test:device/res/e1/200", `{"topic":"test/device/things/live/messages/open","headers":{"correlation-id":"e1"},"status":200}`))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(msgs))
+	assert.Equal(t, 0, tracker.Status().Pending)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 0, len(pub.published()))
+	assert.Equal(t, uint64(0), tracker.Status().TimedOut)
+}
+
+func TestAwsCommandTimeout(t *testing.T) {
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	pub := &topicPublisher{}
+	tracker := NewCommandTracker(reqCache, pub, nil, 50*time.Millisecond, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	msgs, err := newAwsCommandRequestHandler(tracker, nil, deviceID)(commandMessage(executionTopic, `{"subject":"open"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	assertMessageTopic(t, msgs[0], "command//test:device/req/e1/open")
+
+	require.Eventually(t, func() bool { return len(pub.published()) == 1 }, time.Second, 10*time.Millisecond)
+	response := pub.published()[0]
+	assert.Equal(t, "$aws/commands/things/test:device/executions/e1/response/json", response.topic)
+	assert.Contains(t, response.payload, `"status":"TIMED_OUT"`)
+}
+
+func TestCommandTimeoutDefaults(t *testing.T) {
+	tracker := NewCommandTracker(nil, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	assertCommandTimeout(t, tracker, "", 60*time.Second)
+	assertCommandTimeout(t, tracker, "5s", 5*time.Second)
+	assertCommandTimeout(t, tracker, "0", 0)
+
+	tracker = NewCommandTracker(nil, connector.NullPublisher(), nil, 1500*time.Millisecond, nil, nil, watermill.NopLogger{})
+	assertCommandTimeout(t, tracker, "", 1500*time.Millisecond)
+	assert.Equal(t, "1500ms", toDittoTimeout(1500*time.Millisecond))
+	assert.Equal(t, "2s", toDittoTimeout(2*time.Second))
+}
+
+func TestCommandTimeoutInvalid(t *testing.T) {
+	tracker := NewCommandTracker(nil, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	for _, header := range []string{"s", "ms", "m", "-1", "1h", "10 s", "60m", "3600s", "99999999999999999999"} {
+		_, err := tracker.commandTimeout(header)
+		assert.Error(t, err, header)
+	}
+	assertCommandTimeout(t, tracker, "59m", 59*time.Minute)
+	assertCommandTimeout(t, tracker, "250ms", 250*time.Millisecond)
+}
+
+func assertCommandTimeout(t *testing.T, tracker *CommandTracker, header string, expected time.Duration) {
+	timeout, err := tracker.commandTimeout(header)
+	require.NoError(t, err)
+	assert.Equal(t, expected, timeout)
+}
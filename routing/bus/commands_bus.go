@@ -17,29 +17,47 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/eclipse-kanto/aws-connector/config"
+
 	"github.com/ThreeDotsLabs/watermill/message"
-	"github.com/eclipse-kanto/suite-connector/cache"
 	"github.com/eclipse-kanto/suite-connector/connector"
 	"github.com/eclipse-kanto/suite-connector/routing"
 	"github.com/eclipse/ditto-clients-golang/protocol"
 )
 
 const (
-	handlerName = "passthrough_commands_request_handler"
-	topics      = "command//+/req/#,cmd//+/q/#"
+	handlerName         = "passthrough_commands_request_handler"
+	topics              = "command//+/req/#,cmd//+/q/#"
+	responseHandlerName = "commands_response_bus"
 )
 
 // CommandsReqBus creates the commands request bus.
 func CommandsReqBus(router *message.Router,
 	pub message.Publisher,
 	sub message.Subscriber,
-	reqCache *cache.Cache,
+	tracker *CommandTracker,
+	policy *config.CommandPolicy,
+	children *ChildThings,
 	deviceID string,
 ) *message.Handler {
-	handler := filter(deviceID, routing.NewCommandRequestHandler(reqCache, "", deviceID, false))
+	handler := routing.NewCommandRequestHandler(tracker.reqCache, "", deviceID, false)
+	handler = tracker.dedup.requests(filter(deviceID, tracker.auditRequests(authorize(policy, tracker, knownThings(children, tracker, tracker.trackRequests(handler))))))
 	return router.AddHandler(handlerName, topics, sub, connector.TopicEmpty, pub, handler)
 }
 
+// CommandsResBus creates the commands response bus.
+// The responses of the AWS IoT command executions and routed commands are published to their AWS IoT response topic,
+// all other responses are published to the command response topic if their command is still tracked.
+func CommandsResBus(router *message.Router,
+	pub message.Publisher,
+	sub message.Subscriber,
+	tracker *CommandTracker,
+	deviceID string,
+) *message.Handler {
+	handler := commandResponses(tracker, routing.NewCommandResponseHandler(tracker.reqCache, "", "", deviceID, false))
+	return router.AddHandler(responseHandlerName, routing.TopicCommandResponse, sub, connector.TopicEmpty, pub, handler)
+}
+
 // filter creates middleware handler which filter all messages not associated with provided deviceId.
 func filter(deviceID string, h message.HandlerFunc) message.HandlerFunc {
 	return func(msg *message.Message) ([]*message.Message, error) {
@@ -23,6 +23,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/eclipse-kanto/suite-connector/cache"
 	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse-kanto/suite-connector/routing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,8 +31,10 @@ import (
 func TestCommandsReqBus(t *testing.T) {
 	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
 	reqCache := cache.NewTTLCache()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
 
-	CommandsReqBus(router, connector.NullPublisher(), test.NewDummySubscriber(), reqCache, deviceID)
+	CommandsReqBus(router, connector.NullPublisher(), test.NewDummySubscriber(), tracker, nil, nil, deviceID)
 	refRouterPtr := reflect.ValueOf(router)
 	refRouter := reflect.Indirect(refRouterPtr)
 	refHandlers := refRouter.FieldByName(fieldHandlers)
@@ -40,6 +43,21 @@ func TestCommandsReqBus(t *testing.T) {
 	test.AssertRouterHandler(t, handlerName, topics, "", reflect.Indirect(refHandler))
 }
 
+func TestCommandsResBus(t *testing.T) {
+	router, _ := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	reqCache := cache.NewTTLCache()
+	defer reqCache.Close()
+	tracker := NewCommandTracker(reqCache, connector.NullPublisher(), nil, 0, nil, nil, watermill.NopLogger{})
+	defer tracker.Close()
+
+	CommandsResBus(router, connector.NullPublisher(), test.NewDummySubscriber(), tracker, deviceID)
+	refRouter := reflect.Indirect(reflect.ValueOf(router))
+	refHandlers := refRouter.FieldByName(fieldHandlers)
+	assert.Equal(t, 1, refHandlers.Len())
+	refHandler := refHandlers.MapIndex(refHandlers.MapKeys()[0])
+	test.AssertRouterHandler(t, responseHandlerName, routing.TopicCommandResponse, "", reflect.Indirect(refHandler))
+}
+
 func TestFilter(t *testing.T) {
 	h := filter(deviceID, message.PassthroughHandler)
 	assertAccepted(t, h, `{"topic":"test/device/things/live/messages/install"}`)
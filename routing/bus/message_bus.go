@@ -26,9 +26,9 @@ func MessageBus(router *message.Router,
 	pub message.Publisher,
 	sub message.Subscriber,
 	settings *config.CloudSettings,
-	handlers []handlers.MessageHandler,
+	msgHandlers []handlers.MessageHandler,
 ) {
-	for _, handler := range handlers {
+	for _, handler := range msgHandlers {
 		if err := handler.Init(settings, router.Logger()); err != nil {
 			logFields := watermill.LogFields{"handler_name": handler.Name()}
 			router.Logger().Error("skipping handler that cannot be initialized", err, logFields)
@@ -40,6 +40,9 @@ func MessageBus(router *message.Router,
 			router.Logger().Error("skipping handler without any topics", nil, logFields)
 			continue
 		}
+		if aware, ok := handler.(handlers.PublisherAware); ok {
+			aware.SetPublisher(pub)
+		}
 		router.AddHandler(handler.Name(), topics, sub, connector.TopicEmpty, pub, handler.HandleMessage)
 	}
 }
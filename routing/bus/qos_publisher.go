@@ -0,0 +1,46 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+)
+
+type qosPublisher struct {
+	pub message.Publisher
+	qos connector.Qos
+}
+
+// NewQosPublisher creates a publisher which forces the provided QoS level for all published messages.
+// The QoS level of the incoming message is preserved in its context and would otherwise take precedence
+// over the QoS level of the underlying publisher.
+func NewQosPublisher(pub message.Publisher, qos connector.Qos) message.Publisher {
+	return &qosPublisher{
+		pub: pub,
+		qos: qos,
+	}
+}
+
+// Publish sets the configured QoS level to the messages and publishes them with the underlying publisher.
+func (p *qosPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		msg.SetContext(connector.SetQosToCtx(msg.Context(), p.qos))
+	}
+	return p.pub.Publish(topic, messages...)
+}
+
+// Close closes the underlying publisher.
+func (p *qosPublisher) Close() error {
+	return p.pub.Close()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	messages []*message.Message
+}
+
+func (p *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func TestQosPublisher(t *testing.T) {
+	rec := &recordingPublisher{}
+	pub := NewQosPublisher(rec, connector.QosAtMostOnce)
+
+	msg := message.NewMessage("test", []byte("{}"))
+	msg.SetContext(connector.SetQosToCtx(context.Background(), connector.QosAtLeastOnce))
+
+	require.NoError(t, pub.Publish("", msg))
+	require.Equal(t, 1, len(rec.messages))
+	qos, ok := connector.QosFromCtx(rec.messages[0].Context())
+	assert.True(t, ok)
+	assert.Equal(t, connector.QosAtMostOnce, qos)
+	assert.NoError(t, pub.Close())
+}
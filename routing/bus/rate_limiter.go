@@ -0,0 +1,234 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// TopicRateLimiterStatus defines the rate limiter status message topic.
+const TopicRateLimiterStatus = "edge/connection/remote/ratelimit/status"
+
+// Minimum interval between the rate limiter status updates.
+const rateLimiterStatusInterval = time.Second
+
+var errDropped = errors.New("message dropped by rate limiter")
+
+// RateLimiter is a token bucket limiter in front of the AWS IoT publisher.
+// High priority messages are always served before the low priority ones.
+// Low priority messages that cannot be published within the configured maximum delay are dropped.
+// The number of delayed and dropped messages is published as retained message to the status publisher, if provided.
+type RateLimiter struct {
+	pub       message.Publisher
+	statusPub message.Publisher
+	limiter   *rate.Limiter
+	interval  time.Duration
+	maxDelay  time.Duration
+	logger    watermill.LoggerAdapter
+
+	pending int32
+	delayed uint64
+	dropped uint64
+
+	statusMutex sync.Mutex
+	statusTimer *time.Timer
+	closed      bool
+}
+
+// RateLimiterStats contains the number of delayed and dropped messages.
+type RateLimiterStats struct {
+	Delayed uint64 `json:"delayed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+type priorityPublisher struct {
+	limiter  *RateLimiter
+	priority handlers.Priority
+}
+
+// NewRateLimiter creates a rate limiter for the provided publisher, its status is published to the status publisher if not nil.
+func NewRateLimiter(pub, statusPub message.Publisher, settings *config.RateLimitSettings, logger watermill.LoggerAdapter) *RateLimiter {
+	burst := settings.RateLimitBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimiter{
+		pub:       pub,
+		statusPub: statusPub,
+		limiter:   rate.NewLimiter(rate.Limit(settings.RateLimit), burst),
+		interval:  time.Duration(float64(time.Second) / settings.RateLimit),
+		maxDelay:  time.Duration(settings.RateLimitMaxDelay) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+// Close stops the pending status update.
+func (l *RateLimiter) Close() {
+	if l == nil {
+		return
+	}
+
+	l.statusMutex.Lock()
+	defer l.statusMutex.Unlock()
+
+	l.closed = true
+	if l.statusTimer != nil {
+		l.statusTimer.Stop()
+		l.statusTimer = nil
+	}
+}
+
+// Publisher returns a publisher which uses the provided priority for messages without priority in their context.
+func (l *RateLimiter) Publisher(priority handlers.Priority) message.Publisher {
+	return &priorityPublisher{
+		limiter:  l,
+		priority: priority,
+	}
+}
+
+// Stats returns the number of delayed and dropped messages since the limiter creation.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	return RateLimiterStats{
+		Delayed: atomic.LoadUint64(&l.delayed),
+		Dropped: atomic.LoadUint64(&l.dropped),
+	}
+}
+
+// Publish waits for the rate limiter and publishes the messages with the underlying publisher.
+func (p *priorityPublisher) Publish(topic string, messages ...*message.Message) error {
+	var result error
+
+	for _, msg := range messages {
+		priority, ok := handlers.PriorityFromCtx(msg.Context())
+		if !ok {
+			priority = p.priority
+		}
+
+		if err := p.limiter.wait(msg, priority); err != nil {
+			if err != errDropped {
+				result = multierror.Append(result, err)
+			}
+			continue
+		}
+
+		if err := p.limiter.pub.Publish(topic, msg); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "publish of %s failed", msg.UUID))
+		}
+	}
+
+	return result
+}
+
+// Close closes the underlying publisher.
+func (p *priorityPublisher) Close() error {
+	return p.limiter.pub.Close()
+}
+
+// wait blocks until the message is allowed to be published.
+func (l *RateLimiter) wait(msg *message.Message, priority handlers.Priority) (err error) {
+	start := time.Now()
+	defer func() {
+		if delay := time.Since(start); err == nil && delay >= l.interval {
+			atomic.AddUint64(&l.delayed, 1)
+			l.statsChanged()
+			l.logger.Debug("Message publishing delayed by rate limiter", watermill.LogFields{
+				"message_uuid": msg.UUID,
+				"priority":     priority,
+				"delay":        delay.String(),
+			})
+		}
+	}()
+
+	if priority == handlers.PriorityHigh {
+		atomic.AddInt32(&l.pending, 1)
+		defer atomic.AddInt32(&l.pending, -1)
+
+		if err := l.limiter.Wait(msg.Context()); err != nil {
+			return errors.Errorf("publish of %s failed, message cancelled", msg.UUID)
+		}
+		return nil
+	}
+
+	for {
+		if atomic.LoadInt32(&l.pending) == 0 && l.limiter.Allow() {
+			return nil
+		}
+
+		if time.Since(start) > l.maxDelay {
+			dropped := atomic.AddUint64(&l.dropped, 1)
+			l.statsChanged()
+			l.logger.Info("Message dropped by rate limiter", watermill.LogFields{
+				"message_uuid":  msg.UUID,
+				"dropped_total": dropped,
+			})
+			return errDropped
+		}
+
+		timer := time.NewTimer(l.interval)
+		select {
+		case <-msg.Context().Done():
+			timer.Stop()
+			return errors.Errorf("publish of %s failed, message cancelled", msg.UUID)
+		case <-timer.C:
+		}
+	}
+}
+
+// statsChanged schedules the status update, the status is published at most once per status interval.
+func (l *RateLimiter) statsChanged() {
+	if l.statusPub == nil {
+		return
+	}
+
+	l.statusMutex.Lock()
+	defer l.statusMutex.Unlock()
+
+	if l.closed || l.statusTimer != nil {
+		return
+	}
+	l.statusTimer = time.AfterFunc(rateLimiterStatusInterval, l.sendStatus)
+}
+
+// sendStatus publishes the rate limiter stats as retained message.
+func (l *RateLimiter) sendStatus() {
+	l.statusMutex.Lock()
+	closed := l.closed
+	l.statusTimer = nil
+	l.statusMutex.Unlock()
+
+	if closed {
+		return
+	}
+	payload, err := json.Marshal(l.Stats())
+	if err != nil {
+		return
+	}
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.SetContext(connector.SetRetainToCtx(msg.Context(), true))
+	if err := l.statusPub.Publish(TopicRateLimiterStatus, msg); err != nil {
+		l.logger.Error("Cannot publish rate limiter status", err, nil)
+	}
+}
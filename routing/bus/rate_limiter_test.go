@@ -0,0 +1,97 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterDropsLowPriority(t *testing.T) {
+	rec := &recordingPublisher{}
+	settings := &config.RateLimitSettings{RateLimit: 10, RateLimitBurst: 1, RateLimitMaxDelay: 0}
+	limiter := NewRateLimiter(rec, nil, settings, watermill.NopLogger{})
+	pub := limiter.Publisher(handlers.PriorityLow)
+
+	require.NoError(t, pub.Publish("", newMessage("1"), newMessage("2")))
+	assert.Equal(t, 1, len(rec.messages))
+	assert.Equal(t, uint64(1), limiter.Stats().Dropped)
+}
+
+func TestRateLimiterDelaysHighPriority(t *testing.T) {
+	rec := &recordingPublisher{}
+	settings := &config.RateLimitSettings{RateLimit: 20, RateLimitBurst: 1, RateLimitMaxDelay: 0}
+	limiter := NewRateLimiter(rec, nil, settings, watermill.NopLogger{})
+	pub := limiter.Publisher(handlers.PriorityLow)
+
+	high := newMessage("2")
+	high.SetContext(handlers.SetPriorityToCtx(high.Context(), handlers.PriorityHigh))
+
+	require.NoError(t, pub.Publish("", newMessage("1"), high))
+	assert.Equal(t, 2, len(rec.messages))
+	assert.Equal(t, RateLimiterStats{Delayed: 1, Dropped: 0}, limiter.Stats())
+	assert.NoError(t, pub.Close())
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	rec := &recordingPublisher{}
+	settings := &config.RateLimitSettings{RateLimit: 1, RateLimitBurst: 1, RateLimitMaxDelay: 1000}
+	limiter := NewRateLimiter(rec, nil, settings, watermill.NopLogger{})
+	pub := limiter.Publisher(handlers.PriorityHigh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg := newMessage("1")
+	msg.SetContext(ctx)
+
+	require.NoError(t, pub.Publish("", newMessage("0")))
+	assert.Error(t, pub.Publish("", msg))
+	assert.Equal(t, 1, len(rec.messages))
+}
+
+func TestRateLimiterStatus(t *testing.T) {
+	rec := &recordingPublisher{}
+	status := &topicPublisher{}
+	settings := &config.RateLimitSettings{RateLimit: 10, RateLimitBurst: 1, RateLimitMaxDelay: 0}
+	limiter := NewRateLimiter(rec, status, settings, watermill.NopLogger{})
+	defer limiter.Close()
+	pub := limiter.Publisher(handlers.PriorityLow)
+
+	require.NoError(t, pub.Publish("", newMessage("1"), newMessage("2"), newMessage("3")))
+	assert.Empty(t, status.published())
+	assert.Eventually(t, func() bool {
+		return len(status.published()) > 0
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []published{{topic: TopicRateLimiterStatus, payload: `{"delayed":0,"dropped":2}`}}, status.published())
+
+	limiter.Close()
+	require.NoError(t, pub.Publish("", newMessage("4")))
+	time.Sleep(2 * rateLimiterStatusInterval)
+	assert.Equal(t, 1, len(status.published()))
+
+	var disabled *RateLimiter
+	disabled.Close()
+}
+
+func newMessage(uuid string) *message.Message {
+	return message.NewMessage(uuid, []byte("{}"))
+}
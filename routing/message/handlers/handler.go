@@ -26,3 +26,19 @@ type MessageHandler interface {
 	Name() string
 	Topics() string
 }
+
+// PublisherAware represents a message handler that also publishes messages asynchronously, e.g. on timer expiration.
+// The message bus provides its publisher to the handlers that implement this interface.
+type PublisherAware interface {
+	SetPublisher(pub message.Publisher)
+}
+
+// Closer represents a message handler that holds resources to be released on shutdown, e.g. the payload compression encoder.
+type Closer interface {
+	Close() error
+}
+
+// Flusher represents a message handler that holds messages to be published before the shutdown, e.g. the pending telemetry batches.
+type Flusher interface {
+	Flush()
+}
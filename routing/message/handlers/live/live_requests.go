@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package live
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default timeout of the live messages without timeout header.
+const defaultLiveTimeout = 60 * time.Second
+
+type liveRequest struct {
+	thingID string
+	expires time.Time
+}
+
+// LiveRequests keeps the live messages forwarded to AWS IoT until their response or timeout,
+// so that only the responses to these messages are routed back to the local requesters.
+type LiveRequests struct {
+	now func() time.Time
+
+	mutex   sync.Mutex
+	pending map[string]*liveRequest
+}
+
+// NewLiveRequests creates an empty pending live requests registry.
+func NewLiveRequests() *LiveRequests {
+	return &LiveRequests{
+		now:     time.Now,
+		pending: make(map[string]*liveRequest),
+	}
+}
+
+// Sent records the live message with the provided correlation-id, sent on behalf of the provided thing.
+// The timeout is the Ditto timeout header value, e.g. 10s, 500ms or 10 (seconds), it defaults to 60 seconds.
+func (r *LiveRequests) Sent(correlationID, thingID, timeout string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	for id, request := range r.pending {
+		if now.After(request.expires) {
+			delete(r.pending, id)
+		}
+	}
+	r.pending[correlationID] = &liveRequest{thingID: thingID, expires: now.Add(parseTimeout(timeout))}
+}
+
+// Take removes the pending live message with the provided correlation-id and returns the ID of its thing.
+// Returns false if there is no such live message or it has already timed out.
+func (r *LiveRequests) Take(correlationID string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	request, ok := r.pending[correlationID]
+	if !ok {
+		return "", false
+	}
+	delete(r.pending, correlationID)
+	if r.now().After(request.expires) {
+		return "", false
+	}
+	return request.thingID, true
+}
+
+// parseTimeout parses the Ditto timeout header value, a number without unit is in seconds.
+func parseTimeout(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultLiveTimeout
+}
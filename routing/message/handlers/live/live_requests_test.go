@@ -0,0 +1,35 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package live
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeout(t *testing.T) {
+	assert.Equal(t, 10*time.Second, parseTimeout("10"))
+	assert.Equal(t, 500*time.Millisecond, parseTimeout("500ms"))
+	assert.Equal(t, time.Minute, parseTimeout("1m"))
+	assert.Equal(t, defaultLiveTimeout, parseTimeout(""))
+	assert.Equal(t, defaultLiveTimeout, parseTimeout("-1"))
+}
+
+func TestLiveRequestsNil(t *testing.T) {
+	var requests *LiveRequests
+	requests.Sent("c1", "test:device", "")
+	_, ok := requests.Take("c1")
+	assert.False(t, ok)
+}
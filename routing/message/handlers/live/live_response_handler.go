@@ -0,0 +1,134 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/pkg/errors"
+)
+
+const (
+	responseSuffix = "/response"
+
+	// Local topics of the responses, in format command//<thingId>/res/<correlationId>/<status>.
+	topicLocalResponse      = "command//%s/res/%s/%d"
+	topicLocalShortResponse = "c//%s/s/%s/%d"
+)
+
+type liveResponseHandler struct {
+	deviceID string
+	topics   string
+	requests *LiveRequests
+	logger   watermill.LoggerAdapter
+}
+
+// CreateDefaultLiveResponseHandler instantiates a new live response handler that receives the responses
+// of the forwarded Ditto live messages from AWS IoT and routes them back to the local requester.
+// Only the responses to the live messages recorded in the provided pending live requests are accepted.
+func CreateDefaultLiveResponseHandler(requests *LiveRequests) handlers.MessageHandler {
+	return &liveResponseHandler{requests: requests}
+}
+
+// Init builds the AWS IoT topic of the responses from the live topic template.
+// The responses are expected on the live message topic with /response suffix.
+func (h *liveResponseHandler) Init(settings *config.CloudSettings, logger watermill.LoggerAdapter) error {
+	h.logger = logger
+	h.deviceID = settings.DeviceID
+	if len(settings.LiveTopicTemplate) > 0 {
+		h.topics = config.TopicTemplateFilter(settings.LiveTopicTemplate) + responseSuffix
+	}
+	return nil
+}
+
+// HandleMessage processes a Ditto live message response received from AWS IoT.
+// The response must contain the correlation-id header of a pending live message of the same device or child thing,
+// its status defaults to 200. The response is published on the local command response topics of the thing,
+// so that the requester can correlate it.
+func (h *liveResponseHandler) HandleMessage(msg *message.Message) ([]*message.Message, error) {
+	if _, ok := connector.TopicFromCtx(msg.Context()); !ok {
+		return nil, errors.New("no topic in context")
+	}
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	if err := json.Unmarshal(msg.Payload, env); err != nil || env.Topic == nil {
+		h.debug("Invalid live response", map[string]interface{}{"payload": string(msg.Payload)})
+		return nil, errors.New("invalid live response")
+	}
+
+	correlationID := env.Headers.CorrelationID()
+	if len(correlationID) == 0 {
+		h.debug("Live response without correlation-id", map[string]interface{}{"payload": string(msg.Payload)})
+		return nil, errors.New("missing correlation-id of live response")
+	}
+
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	if thingID != h.deviceID && !strings.HasPrefix(thingID, h.deviceID+":") {
+		h.debug("Live response of unknown thing", map[string]interface{}{"thing": thingID})
+		return nil, errors.Errorf("live response of unknown thing '%s'", thingID)
+	}
+
+	if requestThingID, ok := h.requests.Take(correlationID); !ok || requestThingID != thingID {
+		h.debug("Live response without pending request", map[string]interface{}{"correlation-id": correlationID, "thing": thingID})
+		return nil, errors.Errorf("no pending live request with correlation-id '%s'", correlationID)
+	}
+
+	payload := msg.Payload
+	if env.Status == 0 {
+		env.Status = http.StatusOK
+		data, err := json.Marshal(env)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot marshal live response")
+		}
+		payload = data
+	}
+
+	result := make([]*message.Message, 0, 2)
+	for _, template := range []string{topicLocalResponse, topicLocalShortResponse} {
+		topic := fmt.Sprintf(template, thingID, correlationID, env.Status)
+		response := message.NewMessage(watermill.NewUUID(), payload)
+		response.SetContext(connector.SetTopicToCtx(response.Context(), topic))
+		result = append(result, response)
+	}
+
+	h.debug("Route live response", map[string]interface{}{"correlation-id": correlationID, "status": env.Status})
+	return result, nil
+}
+
+// Name returns the message handler name.
+func (h *liveResponseHandler) Name() string {
+	return "live_response_handler"
+}
+
+// Topics returns the AWS IoT topic of the live message responses.
+func (h *liveResponseHandler) Topics() string {
+	return h.topics
+}
+
+func (h *liveResponseHandler) debug(msg string, fields map[string]interface{}) {
+	logFields := watermill.LogFields{"handler_name": h.Name()}
+	for k, v := range fields {
+		logFields[k] = v
+	}
+	h.logger.Debug(msg, logFields)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package live
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDefaultLiveResponseHandler(t *testing.T) {
+	handler := CreateDefaultLiveResponseHandler(NewLiveRequests())
+
+	require.NoError(t, handler.Init(settings(), watermill.NopLogger{}))
+	assert.Equal(t, "live_response_handler", handler.Name())
+	assert.Equal(t, "things/+/live/+/response", handler.Topics())
+
+	handler = CreateDefaultLiveResponseHandler(NewLiveRequests())
+	require.NoError(t, handler.Init(&config.CloudSettings{}, watermill.NopLogger{}))
+	assert.Empty(t, handler.Topics())
+}
+
+func TestLiveResponse(t *testing.T) {
+	requests := NewLiveRequests()
+	requests.Sent("c1", "test:device", "")
+	handler := CreateDefaultLiveResponseHandler(requests)
+	require.NoError(t, handler.Init(settings(), watermill.NopLogger{}))
+
+	payload := `{"topic":"test/device/things/live/messages/reboot","headers":{"correlation-id":"c1","content-type":"application/json"},"path":"/outbox/messages/reboot","value":"ok","status":204}`
+	messages, err := handler.HandleMessage(newMessage("things/test:device/live/reboot/response", payload))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(messages))
+
+	assertTopic(t, messages[0], "command//test:device/res/c1/204")
+	assertTopic(t, messages[1], "c//test:device/s/c1/204")
+	for _, msg := range messages {
+		assert.Equal(t, payload, string(msg.Payload))
+	}
+
+	_, err = handler.HandleMessage(newMessage("things/test:device/live/reboot/response", payload))
+	assert.Error(t, err)
+}
+
+func TestLiveResponseRejected(t *testing.T) {
+	requests := NewLiveRequests()
+	handler := CreateDefaultLiveResponseHandler(requests)
+	require.NoError(t, handler.Init(settings(), watermill.NopLogger{}))
+
+	response := `{"topic":"%s/things/live/messages/reboot","headers":{"correlation-id":"%s"},"path":"/outbox/messages/reboot"}`
+	_, err := handler.HandleMessage(newMessage("things/test:device/live/reboot/response", fmt.Sprintf(response, "test/device", "unknown")))
+	assert.Error(t, err)
+
+	requests.Sent("c1", "test:device:child", "")
+	_, err = handler.HandleMessage(newMessage("things/test:other/live/reboot/response", fmt.Sprintf(response, "test/other", "c1")))
+	assert.Error(t, err)
+
+	requests.Sent("c2", "test:device:child", "")
+	_, err = handler.HandleMessage(newMessage("things/test:device/live/reboot/response", fmt.Sprintf(response, "test/device", "c2")))
+	assert.Error(t, err)
+
+	requests.Sent("c3", "test:device:child", "1")
+	requests.now = func() time.Time {
+		return time.Now().Add(2 * time.Second)
+	}
+	_, err = handler.HandleMessage(newMessage("things/test:device:child/live/reboot/response", fmt.Sprintf(response, "test/device:child", "c3")))
+	assert.Error(t, err)
+}
+
+func TestLiveResponseDefaultStatus(t *testing.T) {
+	requests := NewLiveRequests()
+	requests.Sent("c1", "test:device", "")
+	handler := CreateDefaultLiveResponseHandler(requests)
+	require.NoError(t, handler.Init(settings(), watermill.NopLogger{}))
+
+	payload := `{"topic":"test/device/things/live/messages/reboot","headers":{"correlation-id":"c1"},"path":"/outbox/messages/reboot"}`
+	messages, err := handler.HandleMessage(newMessage("things/test:device/live/reboot/response", payload))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(messages))
+	assert.Contains(t, string(messages[0].Payload), `"status":200`)
+}
+
+func TestInvalidLiveResponse(t *testing.T) {
+	handler := CreateDefaultLiveResponseHandler(NewLiveRequests())
+	require.NoError(t, handler.Init(settings(), watermill.NopLogger{}))
+
+	_, err := handler.HandleMessage(&message.Message{Payload: []byte(`{}`)})
+	assert.Error(t, err)
+
+	_, err = handler.HandleMessage(newMessage("things/test:device/live/reboot/response", `{"value":1}`))
+	assert.Error(t, err)
+
+	_, err = handler.HandleMessage(newMessage("things/test:device/live/reboot/response", `{"topic":"test/device/things/live/messages/reboot","status":200}`))
+	assert.Error(t, err)
+}
+
+func settings() *config.CloudSettings {
+	settings := &config.CloudSettings{}
+	settings.TenantID = "test-tenant-id"
+	settings.DeviceID = "test:device"
+	settings.LiveTopicTemplate = "things/{thingId}/live/{subject}"
+	return settings
+}
+
+func newMessage(topic, payload string) *message.Message {
+	msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), topic))
+	return msg
+}
+
+func assertTopic(t *testing.T, msg *message.Message, expected string) {
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	require.True(t, ok)
+	assert.Equal(t, expected, topic)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// Used to publish messages directly to an AWS IoT rule, bypassing the message broker.
+const topicBasicIngest = "$aws/rules/%s/%s"
+
+// toBasicIngestTopic replaces the message topic with the Basic Ingest topic of the first matching AWS IoT rule.
+func (h *deviceHandler) toBasicIngestTopic(class string, env *protocol.Envelope, msg *message.Message) {
+	if len(h.ingestRules) == 0 {
+		return
+	}
+
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	if !ok {
+		return
+	}
+
+	var dittoTopic, feature, subject string
+	if env != nil {
+		dittoTopic = env.Topic.String()
+		feature = featureFromPath(env.Path)
+		if env.Topic.Criterion == protocol.CriterionMessages {
+			subject = string(env.Topic.Action)
+		}
+	}
+
+	for _, rule := range h.ingestRules {
+		if rule.Matches(class, dittoTopic, feature, subject) {
+			ingestTopic := fmt.Sprintf(topicBasicIngest, rule.RuleName, topic)
+			h.Debug("Forward message to basic ingest topic", map[string]interface{}{"topic": ingestTopic})
+			msg.SetContext(connector.SetTopicToCtx(msg.Context(), ingestTopic))
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicIngest(t *testing.T) {
+	settings := settings()
+	settings.BasicIngestRules = []config.BasicIngestRule{
+		{RuleName: "heat", Subject: "^heatUp$"},
+		{RuleName: "meter", Class: config.MessageClassTelemetry, Feature: "^meter$"},
+		{RuleName: "children", Topic: "^test/device:.*"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	heatUp := `{"topic":"test/device/things/live/messages/heatUp","path":"/inbox/messages/heatUp","value":47}`
+	meter := `{"topic":"test/device/things/twin/events/modified","path":"/features/meter/properties/x","value":1}`
+	child := `{"topic":"test/device:child/things/twin/events/modified","path":"/features/meter/properties/x","value":1}`
+
+	assertTopic(t, settings, "e", heatUp, "$aws/rules/heat/event/test-tenant-id/test:device")
+	assertTopic(t, settings, "t", meter, "$aws/rules/meter/telemetry/test-tenant-id/test:device")
+	assertTopic(t, settings, "e", meter, "event/test-tenant-id/test:device")
+	assertTopic(t, settings, "e", child, "$aws/rules/children/event/test-tenant-id/test:device")
+	assertTopic(t, settings, "e", `{"unknown":true}`, "event/test-tenant-id/test:device")
+}
+
+func assertTopic(t *testing.T, settings *config.CloudSettings, topic string, payload string, expectedTopic string) {
+	messageTopic, _ := requireValidMessageSettings(t, settings, topic, payload)
+	assert.Equal(t, expectedTopic, messageTopic)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+type forwardedValue struct {
+	value interface{}
+	time  time.Time
+}
+
+// deadband suppresses the insignificant changes of the property values, evaluated against their last forwarded values.
+// The values are evaluated on arrival only, i.e. the next value received after maxInterval is forwarded
+// regardless of its change, the last value is never resent on its own.
+type deadband struct {
+	rules []config.DeadbandRule
+	now   func() time.Time
+
+	mutex sync.Mutex
+	last  map[string]*forwardedValue
+}
+
+// deadbandResult counts the leaf values of the evaluated thing data.
+type deadbandResult struct {
+	significant int
+	suppressed  int
+	unmatched   int
+}
+
+func newDeadband(rules []config.DeadbandRule) *deadband {
+	return &deadband{
+		rules: rules,
+		now:   time.Now,
+		last:  make(map[string]*forwardedValue),
+	}
+}
+
+// suppress removes the insignificant changes from the thing data of the Ditto message.
+// If requested, the insignificant changes are replaced with their last forwarded values instead.
+// Returns false if the thing data contains insignificant changes only.
+func (h *deviceHandler) suppress(env *protocol.Envelope, data interface{}, replace bool) (interface{}, bool) {
+	if h.deadband == nil {
+		return data, true
+	}
+
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	data, result := h.deadband.filter(thingID, data, replace)
+	if result.suppressed > 0 && result.significant == 0 && result.unmatched == 0 {
+		h.Debug("Excluded message with insignificant changes", map[string]interface{}{"topic": env.Topic.String()})
+		return nil, false
+	}
+	return data, true
+}
+
+// filter evaluates the leaf values of the thing data and records the significant ones as last forwarded.
+func (d *deadband) filter(thingID string, data interface{}, replace bool) (interface{}, deadbandResult) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	result := deadbandResult{}
+	data, _ = d.walk(thingID, "", data, replace, d.now(), &result)
+	return data, result
+}
+
+// forgetDeleted removes the last forwarded values of the properties deleted by the Ditto message.
+func (h *deviceHandler) forgetDeleted(env *protocol.Envelope) {
+	if h.deadband == nil || !h.isDittoRequest(env) || env.Topic.Channel != protocol.ChannelTwin {
+		return
+	}
+	if (env.Topic.Criterion == protocol.CriterionCommands && env.Topic.Action == protocol.ActionDelete) ||
+		(env.Topic.Criterion == protocol.CriterionEvents && env.Topic.Action == protocol.ActionDeleted) {
+		h.deadband.forget(fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName), env.Path)
+	}
+}
+
+// forget removes the last forwarded values of the thing properties at or below the provided path.
+func (d *deadband) forget(thingID, path string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	prefix := thingID + strings.TrimSuffix(path, "/")
+	for key := range d.last {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			delete(d.last, key)
+		}
+	}
+}
+
+func (d *deadband) walk(thingID, path string, data interface{}, replace bool, now time.Time, result *deadbandResult) (interface{}, bool) {
+	if object, ok := data.(map[string]interface{}); ok && len(object) > 0 {
+		for key, child := range object {
+			if value, keep := d.walk(thingID, path+"/"+key, child, replace, now, result); keep {
+				object[key] = value
+			} else {
+				delete(object, key)
+			}
+		}
+		return object, len(object) > 0
+	}
+
+	rule := d.match(path)
+	if rule == nil {
+		result.unmatched++
+		return data, true
+	}
+
+	key := thingID + path
+	last, ok := d.last[key]
+	if !ok || significant(rule, last, data, now) {
+		result.significant++
+		d.last[key] = &forwardedValue{value: data, time: now}
+		return data, true
+	}
+
+	result.suppressed++
+	if replace {
+		return last.value, true
+	}
+	return nil, false
+}
+
+// match returns the first deadband rule matching the provided property path.
+func (d *deadband) match(path string) *config.DeadbandRule {
+	for i := range d.rules {
+		if d.rules[i].PathRegexp.MatchString(path) {
+			return &d.rules[i]
+		}
+	}
+	return nil
+}
+
+// significant returns true if the value change, compared to the last forwarded value, should be forwarded.
+func significant(rule *config.DeadbandRule, last *forwardedValue, value interface{}, now time.Time) bool {
+	elapsed := now.Sub(last.time)
+	if rule.MinInterval > 0 && elapsed < time.Duration(rule.MinInterval)*time.Millisecond {
+		return false
+	}
+	if rule.MaxInterval > 0 && elapsed >= time.Duration(rule.MaxInterval)*time.Millisecond {
+		return true
+	}
+
+	number, ok := value.(float64)
+	lastNumber, lastOk := last.value.(float64)
+	if !ok || !lastOk {
+		return !reflect.DeepEqual(value, last.value)
+	}
+
+	change := math.Abs(number - lastNumber)
+	if rule.Absolute == 0 && rule.Percent == 0 {
+		return change > 0
+	}
+	if rule.Absolute > 0 && change >= rule.Absolute {
+		return true
+	}
+	if rule.Percent > 0 {
+		if lastNumber == 0 {
+			return change > 0
+		}
+		return change >= math.Abs(lastNumber)*rule.Percent/100
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const temperaturePayload = `{
+	"topic":"test/device/things/twin/events/modified",
+	"path":"/features/climate/properties",
+	"value":{"temperature":%v,"humidity":%v}
+}`
+
+func TestDeadbandAbsolute(t *testing.T) {
+	messageHandler := deadbandHandler(t, config.DeadbandRule{Path: "/properties/(temperature|humidity)$", Absolute: 0.5})
+
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40,"temperature":20}`, 20, 40)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"temperature":20.8}`, 20.8, 40.2)
+	assertTelemetryValue(t, messageHandler.HandleMessage, "", 20.9, 40.3)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40.5}`, 20.9, 40.5)
+}
+
+func TestDeadbandPercent(t *testing.T) {
+	messageHandler := deadbandHandler(t, config.DeadbandRule{Path: "/temperature$", Percent: 10})
+
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40,"temperature":20}`, 20, 40)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40}`, 21, 40)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40,"temperature":22}`, 22, 40)
+}
+
+func TestDeadbandIntervals(t *testing.T) {
+	messageHandler := deadbandHandler(t, config.DeadbandRule{Path: "/properties/", Absolute: 5, MinInterval: 10, MaxInterval: 50})
+	now := time.Now()
+	messageHandler.deadband.now = func() time.Time {
+		return now
+	}
+
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40,"temperature":20}`, 20, 40)
+	assertTelemetryValue(t, messageHandler.HandleMessage, "", 30, 50)
+
+	now = now.Add(20 * time.Millisecond)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":50,"temperature":30}`, 30, 50)
+	assertTelemetryValue(t, messageHandler.HandleMessage, "", 31, 51)
+
+	now = now.Add(60 * time.Millisecond)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":51,"temperature":31}`, 31, 51)
+}
+
+func TestDeadbandDeleted(t *testing.T) {
+	messageHandler := deadbandHandler(t, config.DeadbandRule{Path: "/properties/", Absolute: 5})
+
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"humidity":40,"temperature":20}`, 20, 40)
+	assertTelemetryValue(t, messageHandler.HandleMessage, "", 21, 41)
+
+	handle(t, messageHandler.HandleMessage, "e", `{
+		"topic":"test/device/things/twin/commands/delete",
+		"path":"/features/climate/properties/temperature"
+	}`)
+	assertTelemetryValue(t, messageHandler.HandleMessage, `{"temperature":21}`, 21, 41)
+
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device/things/twin/events/deleted","path":"/"}`)
+	assert.Empty(t, messageHandler.deadband.last)
+}
+
+func TestDeadbandShadow(t *testing.T) {
+	messageHandler := deadbandHandler(t, config.DeadbandRule{Path: "/temperature$", Absolute: 1})
+
+	shadow := `{
+		"topic":"test/device/things/twin/commands/create",
+		"path":"/features/deadband/properties",
+		"value":{"temperature":%v,"humidity":%v}
+	}`
+	messages := handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, 20, 40))
+	require.Equal(t, 1, len(messages))
+	assert.JSONEq(t, `{"state":{"reported":{"temperature":20,"humidity":40}}}`, string(messages[0].Payload))
+
+	messages = handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, 20.5, 45))
+	require.Equal(t, 1, len(messages))
+	assert.JSONEq(t, `{"state":{"reported":{"temperature":20,"humidity":45}}}`, string(messages[0].Payload))
+
+	shadow = `{
+		"topic":"test/device/things/twin/commands/create",
+		"path":"/features/deadband/properties/temperature",
+		"value":%v
+	}`
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, 20.7))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, 21))))
+}
+
+func deadbandHandler(t *testing.T, rule config.DeadbandRule) *deviceHandler {
+	settings := settings()
+	settings.Deadbands = []config.DeadbandRule{rule}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+	return messageHandler.(*deviceHandler)
+}
+
+// assertTelemetryValue sends the telemetry and asserts the forwarded value, empty value means no message is forwarded.
+func assertTelemetryValue(t *testing.T, h func(*message.Message) ([]*message.Message, error), value string, temperature, humidity float64) {
+	messages := handle(t, h, "t", fmt.Sprintf(temperaturePayload, temperature, humidity))
+	if len(value) == 0 {
+		assert.Equal(t, 0, len(messages))
+		return
+	}
+	require.Equal(t, 1, len(messages))
+	assert.Contains(t, string(messages[0].Payload), `"value":`+value)
+}
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/eclipse-kanto/aws-connector/config"
 	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
@@ -49,18 +50,54 @@ const (
 )
 
 type deviceHandler struct {
-	tenantID          string
-	deviceID          string
-	payloadFilters    []*regexp.Regexp
-	topicFilter       *regexp.Regexp
-	logger            watermill.LoggerAdapter
-	defaultHandler    message.HandlerFunc
-	shadowStateHolder ShadowStateHolder
+	tenantID               string
+	deviceID               string
+	payloadFilters         []*regexp.Regexp
+	topicFilter            *regexp.Regexp
+	topicFilters           []*topicFilter
+	scopedPayloadFilters   []config.ScopedPayloadFilter
+	telemetryQos           connector.Qos
+	eventsQos              connector.Qos
+	shadowQos              connector.Qos
+	batcher                *telemetryBatcher
+	compressor             *payloadCompressor
+	ingestRules            []config.BasicIngestRule
+	telemetryTopicTemplate string
+	eventsTopicTemplate    string
+	outputFormats          []config.OutputFormatRule
+	siteWise               *siteWiseConverter
+	siteWiseAliasTemplate  string
+	transformations        []config.TransformRule
+	routeConditions        []config.RouteCondition
+	deadband               *deadband
+	liveTopicTemplate      string
+	liveRequests           LiveRequestsObserver
+	gateway                config.GatewaySettings
+	logger                 watermill.LoggerAdapter
+	defaultHandler         message.HandlerFunc
+	shadowStateHolder      ShadowStateHolder
+	thingsObserver         ThingsObserver
+	thingsRegistry         ThingsRegistry
+	registry               *registrySync
+}
+
+// DeviceHandlerOption configures an optional collaborator of the passthrough handler.
+type DeviceHandlerOption func(*deviceHandler)
+
+// WithThingsObserver sets the things observer notified on the creation and deletion of the device things.
+func WithThingsObserver(thingsObserver ThingsObserver) DeviceHandlerOption {
+	return func(h *deviceHandler) {
+		h.thingsObserver = thingsObserver
+	}
 }
 
 // CreateDefaultDeviceHandler instantiates a new passthrough handler that forwards messages received from local message broker on event and telemetry topics as device-to-cloud messages.
-func CreateDefaultDeviceHandler(shadowStateHolder ShadowStateHolder) handlers.MessageHandler {
-	return &deviceHandler{shadowStateHolder: shadowStateHolder}
+func CreateDefaultDeviceHandler(shadowStateHolder ShadowStateHolder, options ...DeviceHandlerOption) handlers.MessageHandler {
+	h := &deviceHandler{shadowStateHolder: shadowStateHolder}
+	for _, option := range options {
+		option(h)
+	}
+	return h
 }
 
 // Init gets the device ID that is needed for the message forwarding towards AWS IoT Hub.
@@ -69,7 +106,47 @@ func (h *deviceHandler) Init(settings *config.CloudSettings, logger watermill.Lo
 	h.deviceID = settings.DeviceID
 	h.payloadFilters = settings.PayloadFiltersRegexp
 	h.topicFilter = settings.TopicFilterRegexp
+	h.topicFilters = newTopicFilters(settings.TopicFilters)
+	h.scopedPayloadFilters = settings.ScopedPayloadFilters
+	h.telemetryQos = connector.Qos(settings.TelemetryQos)
+	h.eventsQos = connector.Qos(settings.EventsQos)
+	h.shadowQos = connector.Qos(settings.ShadowUpdatesQos)
+	h.ingestRules = settings.BasicIngestRules
+	h.telemetryTopicTemplate = settings.TelemetryTopicTemplate
+	h.eventsTopicTemplate = settings.EventsTopicTemplate
+	h.outputFormats = settings.OutputFormats
+	h.transformations = settings.Transformations
+	h.routeConditions = settings.RouteConditions
+	h.liveTopicTemplate = settings.LiveTopicTemplate
+	h.gateway = settings.GatewaySettings
+	h.registry = nil
+	if len(settings.RegistryAttributes) > 0 {
+		h.registry = newRegistrySync(&settings.RegistrySettings, h.eventsQos, logger)
+	}
+	h.thingsRegistry = nil
+	if registry, ok := h.thingsObserver.(ThingsRegistry); ok && settings.ChildRegistration {
+		h.thingsRegistry = registry
+	}
+	if len(settings.Deadbands) > 0 {
+		h.deadband = newDeadband(settings.Deadbands)
+	}
 	h.logger = logger
+	if len(settings.Compression) > 0 {
+		compressor, err := newPayloadCompressor(&settings.CompressionSettings, logger)
+		if err != nil {
+			return err
+		}
+		h.compressor = compressor
+	}
+	if settings.TelemetryBatchWindow > 0 {
+		window := time.Duration(settings.TelemetryBatchWindow) * time.Millisecond
+		h.batcher = newTelemetryBatcher(window, settings.TelemetryBatchMaxBytes, h.telemetryQos, h.compressor, logger)
+	}
+	if len(settings.SiteWiseTopic) > 0 {
+		window := time.Duration(settings.SiteWiseWindow) * time.Millisecond
+		h.siteWise = newSiteWiseConverter(settings.SiteWiseTopic, window, h.telemetryQos, logger)
+		h.siteWiseAliasTemplate = settings.SiteWiseAliasTemplate
+	}
 	h.defaultHandler = routing.AddTimestamp(routing.NewEventsHandler("", h.tenantID, h.deviceID, false))
 	return nil
 }
@@ -98,13 +175,146 @@ func (h *deviceHandler) HandleMessage(msg *message.Message) ([]*message.Message,
 	h.Debug("Handle message", map[string]interface{}{"payload": string(msg.Payload)})
 	// Parse message payload (JSON)
 	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
-	if err := json.Unmarshal(msg.Payload, &env); err == nil {
+	if json.Unmarshal(msg.Payload, &env) != nil || env.Topic == nil {
+		// Check the message against the allow and deny topic filters
+		if !h.isAllowed(nil, msg) {
+			return []*message.Message{}, nil
+		}
+		return h.forwardMessage(nil, "", msg)
+	}
+	// Notify the things observer on the thing creation or deletion
+	h.observeThing(env)
+	// Reset the deadband state of the deleted properties
+	h.forgetDeleted(env)
+	// Check the message against the allow and deny topic filters and the route conditions of its class
+	if !h.isAllowed(env, msg) {
+		return []*message.Message{}, nil
+	}
+	class := h.messageClass(env, msg)
+	if !h.isRouted(class, env) {
+		return []*message.Message{}, nil
+	}
+	messages, err := h.forwardMessage(env, class, msg)
+	if err != nil {
+		return nil, err
+	}
+	// Sync the selected attributes of the forwarded message to the AWS IoT registry (if configured)
+	messages = append(messages, h.toRegistryMessages(env)...)
+	// Hold the messages of the child thing until its AWS IoT thing is registered
+	return h.holdMessages(env, messages), nil
+}
+
+// forwardMessage converts the incoming message of the provided class, parsed to the provided Ditto envelope if not nil,
+// to its device-to-cloud messages. The message must pass the topic filters and the route conditions of its class.
+func (h *deviceHandler) forwardMessage(env *protocol.Envelope, class string, msg *message.Message) ([]*message.Message, error) {
+	if env != nil {
+		// Forward the live messages and events to their AWS IoT topic (if configured)
+		if live, ok := h.toLiveMessage(env, msg); ok {
+			return []*message.Message{live}, nil
+		}
 		// Convert incoming message to shadow messages (if needed)
 		if messages, ok := h.toShadowMessages(env); ok {
 			return messages, nil
 		}
+		// Apply the payload transformations and deadband rules to the non-shadow message
+		rewritten, ok := h.rewriteMessage(class, env, msg)
+		if !ok {
+			return []*message.Message{}, nil
+		}
+		msg = rewritten
+	}
+	messages, err := h.defaultHandler(msg)
+	if err != nil {
+		return nil, err
+	}
+	result := []*message.Message{}
+	for _, message := range messages {
+		class, qos := config.MessageClassEvents, h.eventsQos
+		if isTelemetry(message) {
+			class, qos = config.MessageClassTelemetry, h.telemetryQos
+		}
+		message.SetContext(connector.SetQosToCtx(message.Context(), qos))
+		if class == config.MessageClassTelemetry && env != nil && h.siteWise != nil {
+			if siteWiseMessages, ok := h.toSiteWiseMessages(env, message); ok {
+				result = append(result, siteWiseMessages...)
+				continue
+			}
+		}
+		h.toTemplateTopic(class, env, message)
+		h.toBasicIngestTopic(class, env, message)
+		h.toOutputFormat(env, message)
+
+		if class == config.MessageClassTelemetry && env != nil && h.batcher != nil {
+			result = append(result, h.batcher.add(env, message)...)
+		} else {
+			h.compress(class, message)
+			result = append(result, message)
+		}
+	}
+	return result, nil
+}
+
+// SetPublisher sets the publisher used for the telemetry batches and SiteWise property values flushed on time window expiration.
+func (h *deviceHandler) SetPublisher(pub message.Publisher) {
+	if h.batcher != nil {
+		h.batcher.setPublisher(pub)
+	}
+	if h.siteWise != nil {
+		h.siteWise.setPublisher(pub)
 	}
-	return h.defaultHandler(msg)
+}
+
+// holdMessages returns the messages to be forwarded, the messages of the child things waiting for the registration
+// of their AWS IoT things are held by the things registry.
+func (h *deviceHandler) holdMessages(env *protocol.Envelope, messages []*message.Message) []*message.Message {
+	if h.thingsRegistry == nil || len(messages) == 0 {
+		return messages
+	}
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	if thingID == h.deviceID || !h.thingsRegistry.Hold(thingID, messages) {
+		return messages
+	}
+	h.Debug("Messages held until child thing registration", map[string]interface{}{"thing": thingID})
+	return []*message.Message{}
+}
+
+// thingName returns the AWS IoT thing name of the thing with the provided ID.
+func (h *deviceHandler) thingName(thingID string) string {
+	if h.thingsRegistry != nil {
+		return h.thingsRegistry.ThingName(thingID)
+	}
+	return h.gateway.ThingName(h.deviceID, thingID)
+}
+
+// Flush publishes the pending telemetry batches and SiteWise property values, e.g. on shutdown.
+func (h *deviceHandler) Flush() {
+	if h.batcher != nil {
+		h.batcher.flush()
+	}
+	if h.siteWise != nil {
+		h.siteWise.flushExpired()
+	}
+}
+
+// Close releases the resources held by the handler, e.g. the payload compression encoder.
+func (h *deviceHandler) Close() error {
+	if h.compressor != nil {
+		return h.compressor.close()
+	}
+	return nil
+}
+
+// compress compresses the message payload if compression is enabled for the provided message class.
+func (h *deviceHandler) compress(class string, msg *message.Message) {
+	if h.compressor != nil {
+		h.compressor.compress(class, msg)
+	}
+}
+
+// isTelemetry returns true if the provided message is forwarded on a telemetry topic.
+func isTelemetry(msg *message.Message) bool {
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	return ok && strings.HasPrefix(topic, "telemetry/")
 }
 
 // toShadowTopic convert Ditto topic to its corresponding device shadow topic and if its an update message.
@@ -118,6 +328,15 @@ func (h *deviceHandler) toShadowTopic(topic *protocol.Topic, featureName string,
 	}
 	topicID := fmt.Sprintf("%s:%s", topic.Namespace, topic.EntityName)
 
+	if len(h.deviceID) != len(topicID) && h.gateway.GatewayMode {
+		// In gateway mode the child thing is represented by its own AWS IoT thing.
+		thingName := h.thingName(topicID)
+		if featureName == "" {
+			return fmt.Sprintf(topicRootShadow, thingName, target), update, thingName
+		}
+		return fmt.Sprintf(topicNamedShadow, thingName, featureName, target), update, thingName + "/" + featureName
+	}
+
 	if len(h.deviceID) == len(topicID) {
 		if featureName == "" {
 			// Update root thing attributes.
@@ -143,6 +362,25 @@ func (h *deviceHandler) isDittoRequest(env *protocol.Envelope) bool {
 		(id == h.deviceID || strings.HasPrefix(id, h.deviceID+":"))
 }
 
+// observeThing notifies the things observer if provided message is a device thing creation or deletion.
+func (h *deviceHandler) observeThing(env *protocol.Envelope) {
+	if h.thingsObserver == nil || !h.isDittoRequest(env) || env.Topic.Channel != protocol.ChannelTwin {
+		return
+	}
+	if len(env.Path) > 0 && env.Path != "/" {
+		return
+	}
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	switch {
+	case env.Topic.Criterion == protocol.CriterionCommands && env.Topic.Action == protocol.ActionCreate,
+		env.Topic.Criterion == protocol.CriterionEvents && env.Topic.Action == protocol.ActionCreated:
+		h.thingsObserver.ThingCreated(thingID)
+	case env.Topic.Criterion == protocol.CriterionCommands && env.Topic.Action == protocol.ActionDelete,
+		env.Topic.Criterion == protocol.CriterionEvents && env.Topic.Action == protocol.ActionDeleted:
+		h.thingsObserver.ThingDeleted(thingID)
+	}
+}
+
 // isShadowMessage returns true if provided message is device twin/shadow request.
 func (h *deviceHandler) isShadowMessage(env *protocol.Envelope) bool {
 	topic := env.Topic
@@ -201,7 +439,8 @@ func (h *deviceHandler) toShadowMessage(env *protocol.Envelope, featureName stri
 	h.Debug("Send message", map[string]interface{}{"topic": topic, "payload": string(payload)})
 
 	message := message.NewMessage(watermill.NewUUID(), payload)
-	message.SetContext(connector.SetTopicToCtx(message.Context(), topic))
+	ctx := connector.SetQosToCtx(connector.SetTopicToCtx(message.Context(), topic), h.shadowQos)
+	message.SetContext(handlers.SetPriorityToCtx(ctx, handlers.PriorityHigh))
 	return message
 }
 
@@ -318,10 +557,16 @@ func (h *deviceHandler) getFeatureProperties(obj interface{}) (interface{}, bool
 	return res, len(res) > 0
 }
 
-// filterPayload removes the matched paths of provided JSON data.
-func (h *deviceHandler) filterPayload(data interface{}) interface{} {
-	if len(h.payloadFilters) > 0 {
-		if rem, value := h._filterPayload("", data); !rem {
+// filterPayload removes the matched paths of provided JSON data of the provided thing.
+func (h *deviceHandler) filterPayload(thingID string, data interface{}) interface{} {
+	scoped := []*config.ScopedPayloadFilter{}
+	for i := range h.scopedPayloadFilters {
+		if filter := &h.scopedPayloadFilters[i]; filter.MatchesThing(thingID) {
+			scoped = append(scoped, filter)
+		}
+	}
+	if len(h.payloadFilters) > 0 || len(scoped) > 0 {
+		if rem, value := h._filterPayload("", data, scoped); !rem {
 			return value
 		}
 		return nil
@@ -330,10 +575,10 @@ func (h *deviceHandler) filterPayload(data interface{}) interface{} {
 }
 
 // _filterPayload removes the matched paths of provided JSON data. This function will be called recursively.
-func (h *deviceHandler) _filterPayload(path string, data interface{}) (bool, interface{}) {
+func (h *deviceHandler) _filterPayload(path string, data interface{}, scoped []*config.ScopedPayloadFilter) (bool, interface{}) {
 	if mData, ok := data.(map[string]interface{}); ok {
 		for name, value := range mData {
-			rem, val := h._filterPayload(fmt.Sprintf("%s/%s", path, name), value)
+			rem, val := h._filterPayload(fmt.Sprintf("%s/%s", path, name), value, scoped)
 			if rem {
 				delete(mData, name)
 			} else {
@@ -343,7 +588,7 @@ func (h *deviceHandler) _filterPayload(path string, data interface{}) (bool, int
 		return len(mData) == 0, data
 	} else if aData, ok := data.([]interface{}); ok {
 		for index := len(aData) - 1; index >= 0; index-- {
-			rem, val := h._filterPayload(fmt.Sprintf("%s/%d", path, index), aData[index])
+			rem, val := h._filterPayload(fmt.Sprintf("%s/%d", path, index), aData[index], scoped)
 			if rem {
 				aData = append(aData[:index], aData[index+1:]...)
 			} else {
@@ -360,6 +605,13 @@ func (h *deviceHandler) _filterPayload(path string, data interface{}) (bool, int
 			return true, data
 		}
 	}
+	feature := featureFromPath(path)
+	for _, filter := range scoped {
+		if filter.Excludes(feature, path) {
+			h.Debug("Excluded JSON path by scoped filter", map[string]interface{}{"path": path, "mode": filter.Mode})
+			return true, data
+		}
+	}
 	return false, data
 }
 
@@ -373,10 +625,17 @@ func (h *deviceHandler) toShadowMessages(env *protocol.Envelope) ([]*message.Mes
 		}
 
 		value := integrate(strings.Split(env.Path, "/"), env.Value)
-		value = h.filterPayload(value)
+		value = h.filterPayload(fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName), value)
 		if value == nil {
 			return messages, true
 		}
+		value = h.transform(env, value)
+		if env.Topic.Action != protocol.ActionDelete {
+			var significant bool
+			if value, significant = h.suppress(env, value, true); !significant {
+				return messages, true
+			}
+		}
 
 		// Prepare update messages for found attributes.
 		search(valueAttributesTag, value, func(attributes map[string]interface{}) {
@@ -423,6 +423,28 @@ func TestPayloadFilter(t *testing.T) {
 	assert.Equal(t, `{"state":{"reported":{"code":[{"keep":201}],"status":200}}}`, messagePayload)
 }
 
+func TestPayloadFilterJSONSyntax(t *testing.T) {
+	payload := `{
+		"topic":"test/device:edge:containers/things/twin/commands/create",
+		"path":"/features/syntax/properties",
+		"value":{
+			"code":[
+				{"value":"test"},
+				{"keep":201},
+				{"unwanted":500}
+			],
+			"status":200,
+			"unwanted":1234
+		}
+	}`
+	topic := "event"
+
+	settings := filters(t, "", "jsonpath:$..unwanted", "jsonpointer:/features/syntax/properties/code/0")
+	messageTopic, messagePayload := requireValidMessageSettings(t, settings, topic, payload)
+	assert.Equal(t, "$aws/things/test:device/shadow/name/edge:containers:syntax/update", messageTopic)
+	assert.Equal(t, `{"state":{"reported":{"code":[{"keep":201}],"status":200}}}`, messagePayload)
+}
+
 func TestPayloadFilterEntireValue(t *testing.T) {
 	payload := `{
 		"topic":"test/device:edge:containers/things/twin/commands/modify",
@@ -448,6 +470,38 @@ func TestPayloadFilterEntireValue(t *testing.T) {
 	require.Equal(t, 0, len(messages))
 }
 
+func TestScopedPayloadFilters(t *testing.T) {
+	payload := `{
+		"topic":"test/device:vendor:%s/things/twin/commands/create",
+		"path":"/features/%s/properties",
+		"value":{
+			"status":200,
+			"debug":{"trace":1},
+			"serial":"A1"
+		}
+	}`
+	topic := "event"
+
+	settings := filters(t, "", ".*/trace$")
+	settings.ScopedPayloadFilters = []config.ScopedPayloadFilter{
+		{Thing: "^test:device:vendor:a$", Paths: config.PayloadFiltersType{"/serial$"}},
+		{Thing: "^test:device:vendor:b$", Feature: "^meter$", Mode: config.PayloadFilterInclude, Paths: config.PayloadFiltersType{"/status$"}},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	_, messagePayload := requireValidMessageSettings(t, settings, topic, fmt.Sprintf(payload, "a", "meter"))
+	assert.JSONEq(t, `{"state":{"reported":{"status":200}}}`, messagePayload)
+
+	_, messagePayload = requireValidMessageSettings(t, settings, topic, fmt.Sprintf(payload, "b", "meter"))
+	assert.JSONEq(t, `{"state":{"reported":{"status":200}}}`, messagePayload)
+
+	_, messagePayload = requireValidMessageSettings(t, settings, topic, fmt.Sprintf(payload, "b", "other"))
+	assert.JSONEq(t, `{"state":{"reported":{"status":200,"serial":"A1"}}}`, messagePayload)
+
+	_, messagePayload = requireValidMessageSettings(t, settings, topic, fmt.Sprintf(payload, "c", "meter"))
+	assert.JSONEq(t, `{"state":{"reported":{"status":200,"serial":"A1"}}}`, messagePayload)
+}
+
 func TestTopicFilter(t *testing.T) {
 	payload := `{
 		"topic":"test/device:edge:containers/things/twin/commands/modify",
@@ -560,6 +614,36 @@ func assertEvent(t *testing.T, prefix string, topic string) {
 	assert.NotEmpty(t, env.Headers.Generic("x-timestamp"))
 }
 
+func TestMessagesQos(t *testing.T) {
+	settings := settings()
+	settings.TelemetryQos = 0
+	settings.EventsQos = 1
+	settings.ShadowUpdatesQos = 0
+
+	live := `{"topic":"test/device/things/live/messages/heatUp","path":"/inbox/messages/heatUp","value":47}`
+	twin := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/test","value":200}`
+
+	assertQos(t, settings, "t", live, connector.QosAtMostOnce)
+	assertQos(t, settings, "e", live, connector.QosAtLeastOnce)
+	assertQos(t, settings, "event", twin, connector.QosAtMostOnce)
+}
+
+func assertQos(t *testing.T, settings *config.CloudSettings, topic string, payload string, expectedQos connector.Qos) {
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	msg := &message.Message{Payload: []byte(payload)}
+	msg.SetContext(connector.SetQosToCtx(connector.SetTopicToCtx(msg.Context(), topic), connector.QosAtLeastOnce))
+
+	messages, err := messageHandler.HandleMessage(msg)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(messages))
+
+	qos, ok := connector.QosFromCtx(messages[0].Context())
+	require.True(t, ok)
+	assert.Equal(t, expectedQos, qos)
+}
+
 func assertDelete(t *testing.T, child string, path string, expectedTopic string, expectedPayload string) {
 	payload := fmt.Sprintf(`{
 		"topic":"test/device%s/things/twin/commands/delete",
@@ -613,3 +697,27 @@ func filters(t *testing.T, topic string, payload ...string) *config.CloudSetting
 	require.NoError(t, settings.CompileFilters())
 	return settings
 }
+
+func TestHandleGatewayModeShadows(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	settings.ChildThingNameTemplate = "{entityName}"
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	modify := `{"topic":"test/device:door/things/twin/commands/modify","path":"/features/lock/properties","value":{"locked":true}}`
+	messages := handle(t, messageHandler.HandleMessage, "event", modify)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "$aws/things/device:door/shadow/name/lock/update")
+
+	modify = `{"topic":"test/device:door/things/twin/commands/modify","path":"/attributes","value":{"color":"red"}}`
+	messages = handle(t, messageHandler.HandleMessage, "event", modify)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "$aws/things/device:door/shadow/update")
+
+	modify = `{"topic":"test/device/things/twin/commands/modify","path":"/features/lock/properties","value":{"locked":true}}`
+	messages = handle(t, messageHandler.HandleMessage, "event", modify)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "$aws/things/test:device/shadow/name/lock/update")
+}
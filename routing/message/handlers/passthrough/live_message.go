@@ -0,0 +1,70 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// LiveRequestsObserver is notified on the live messages forwarded to AWS IoT, so that their responses can be accepted.
+type LiveRequestsObserver interface {
+	// Sent is called when the live message with the provided correlation-id and Ditto timeout header is forwarded
+	Sent(correlationID, thingID, timeout string)
+}
+
+// WithLiveRequests sets the observer of the forwarded live messages.
+func WithLiveRequests(liveRequests LiveRequestsObserver) DeviceHandlerOption {
+	return func(h *deviceHandler) {
+		h.liveRequests = liveRequests
+	}
+}
+
+// toLiveMessage returns the Ditto live message or event forwarded to the AWS IoT topic of the live topic template.
+// The payload is kept unchanged, so its correlation-id and content-type headers are preserved.
+func (h *deviceHandler) toLiveMessage(env *protocol.Envelope, msg *message.Message) (*message.Message, bool) {
+	if len(h.liveTopicTemplate) == 0 || !h.isLiveMessage(env) {
+		return nil, false
+	}
+
+	values := h.templateValues(config.MessageClassEvents, "", env)
+	// The subject of the live events is their name.
+	values[config.PlaceholderSubject] = string(env.Topic.Action)
+	topic := config.ExpandTopicTemplate(h.liveTopicTemplate, values)
+
+	correlationID := env.Headers.CorrelationID()
+	h.Debug("Send live message", map[string]interface{}{"topic": topic, "correlation-id": correlationID})
+	if h.liveRequests != nil && env.Topic.Criterion == protocol.CriterionMessages && len(correlationID) > 0 {
+		thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+		h.liveRequests.Sent(correlationID, thingID, env.Headers.Timeout())
+	}
+
+	live := message.NewMessage(watermill.NewUUID(), msg.Payload)
+	ctx := connector.SetQosToCtx(connector.SetTopicToCtx(live.Context(), topic), h.eventsQos)
+	live.SetContext(handlers.SetPriorityToCtx(ctx, handlers.PriorityHigh))
+	return live, true
+}
+
+// isLiveMessage returns true if the Ditto message is a live message or event request.
+func (h *deviceHandler) isLiveMessage(env *protocol.Envelope) bool {
+	topic := env.Topic
+	return h.isDittoRequest(env) && topic.Channel == protocol.ChannelLive &&
+		(topic.Criterion == protocol.CriterionMessages || topic.Criterion == protocol.CriterionEvents)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveMessages(t *testing.T) {
+	settings := settings()
+	settings.LiveTopicTemplate = "things/{thingId}/live/{subject}"
+
+	requests := &liveRequestsMock{}
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder, WithLiveRequests(requests))
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	payload := `{"topic":"test/device:child/things/live/messages/reboot","headers":{"correlation-id":"c1","content-type":"application/json","timeout":"10s"},"path":"/outbox/messages/reboot","value":{"delay":5}}`
+	messages := handle(t, messageHandler.HandleMessage, "e", payload)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "things/test:device:child/live/reboot")
+	assert.Equal(t, payload, string(messages[0].Payload))
+	qos, _ := connector.QosFromCtx(messages[0].Context())
+	assert.Equal(t, connector.Qos(settings.EventsQos), qos)
+
+	event := `{"topic":"test/device/things/live/events/overheated","path":"/features/climate/outbox/messages/overheated","value":90}`
+	messages = handle(t, messageHandler.HandleMessage, "event", event)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "things/test:device/live/overheated")
+	assert.Equal(t, []string{"c1 test:device:child 10s"}, requests.sent)
+
+	twin := `{"topic":"test/device/things/twin/events/modified","path":"/features/climate/properties","value":{"temperature":1}}`
+	messages = handle(t, messageHandler.HandleMessage, "e", twin)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/test:device")
+}
+
+func TestLiveMessagesDisabled(t *testing.T) {
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings(), watermill.NopLogger{}))
+
+	payload := `{"topic":"test/device/things/live/messages/reboot","path":"/outbox/messages/reboot","value":{"delay":5}}`
+	messages := handle(t, messageHandler.HandleMessage, "e", payload)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/test:device")
+}
+
+type liveRequestsMock struct {
+	sent []string
+}
+
+func (m *liveRequestsMock) Sent(correlationID, thingID, timeout string) {
+	m.sent = append(m.sent, correlationID+" "+thingID+" "+timeout)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+const (
+	fieldValue     = "value"
+	fieldPath      = "path"
+	fieldTimestamp = "timestamp"
+
+	headerTimestamp = "x-timestamp"
+)
+
+// toOutputFormat replaces the message payload with the output format of the first rule matching the Ditto topic.
+func (h *deviceHandler) toOutputFormat(env *protocol.Envelope, msg *message.Message) {
+	if env == nil || len(h.outputFormats) == 0 {
+		return
+	}
+
+	dittoTopic := env.Topic.String()
+	for _, rule := range h.outputFormats {
+		if rule.Matches(dittoTopic) {
+			if rule.Format == config.OutputFormatValue {
+				h.toValueFormat(&rule, msg)
+			}
+			return
+		}
+	}
+}
+
+// toValueFormat replaces the message envelope with its value, optionally extended with the path, timestamp and selected headers.
+func (h *deviceHandler) toValueFormat(rule *config.OutputFormatRule, msg *message.Message) {
+	// The message payload contains the timestamp header added by the default handler.
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	if err := json.Unmarshal(msg.Payload, env); err != nil {
+		return
+	}
+
+	var output interface{} = env.Value
+	if rule.Path || rule.Timestamp || len(rule.Headers) > 0 {
+		fields := map[string]interface{}{fieldValue: env.Value}
+		if rule.Path {
+			fields[fieldPath] = env.Path
+		}
+		if rule.Timestamp {
+			fields[fieldTimestamp] = env.Headers.Values[headerTimestamp]
+		}
+		for _, header := range rule.Headers {
+			if value, ok := env.Headers.Values[header]; ok {
+				fields[header] = value
+			}
+		}
+		output = fields
+	}
+
+	if payload, err := json.Marshal(output); err == nil {
+		msg.Payload = payload
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const meterPayload = `{
+	"topic":"test/device/things/twin/events/modified",
+	"headers":{"correlation-id":"meter-1","content-type":"application/json"},
+	"path":"/features/meter/properties/x",
+	"value":{"power":12.5}
+}`
+
+func TestOutputFormatValue(t *testing.T) {
+	settings := settings()
+	settings.OutputFormats = []config.OutputFormatRule{
+		{Topic: "^test/device:child/", Format: config.OutputFormatEnvelope},
+		{Format: config.OutputFormatValue},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	_, payload := requireValidMessageSettings(t, settings, "t", meterPayload)
+	assert.JSONEq(t, `{"power":12.5}`, payload)
+
+	child := `{"topic":"test/device:child/things/twin/events/modified","path":"/features/meter","value":1}`
+	_, payload = requireValidMessageSettings(t, settings, "t", child)
+	assert.Contains(t, payload, `"topic":"test/device:child/things/twin/events/modified"`)
+
+	_, payload = requireValidMessageSettings(t, settings, "t", `{"unknown":true}`)
+	assert.Contains(t, payload, `"unknown":true`)
+}
+
+func TestOutputFormatValueFields(t *testing.T) {
+	settings := settings()
+	settings.OutputFormats = []config.OutputFormatRule{{
+		Topic:     "^test/device/things/twin/",
+		Format:    config.OutputFormatValue,
+		Path:      true,
+		Timestamp: true,
+		Headers:   []string{"correlation-id", "missing"},
+	}}
+	require.NoError(t, settings.CompileFilters())
+
+	_, payload := requireValidMessageSettings(t, settings, "e", meterPayload)
+
+	fields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(payload), &fields))
+	assert.Equal(t, map[string]interface{}{"power": 12.5}, fields["value"])
+	assert.Equal(t, "/features/meter/properties/x", fields["path"])
+	assert.Equal(t, "meter-1", fields["correlation-id"])
+	assert.NotNil(t, fields["timestamp"])
+	assert.NotContains(t, fields, "missing")
+	assert.NotContains(t, fields, "content-type")
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/klauspost/compress/zstd"
+)
+
+// payloadCompressor compresses the payload of the messages sent toward AWS IoT and marks them with a topic suffix.
+type payloadCompressor struct {
+	algorithm string
+	threshold int
+	classes   map[string]bool
+	encoder   *zstd.Encoder
+	logger    watermill.LoggerAdapter
+}
+
+func newPayloadCompressor(settings *config.CompressionSettings, logger watermill.LoggerAdapter) (*payloadCompressor, error) {
+	c := &payloadCompressor{
+		algorithm: settings.Compression,
+		threshold: settings.CompressionThreshold,
+		classes:   make(map[string]bool),
+		logger:    logger,
+	}
+	for _, class := range strings.Split(settings.CompressionClasses, ",") {
+		c.classes[strings.TrimSpace(class)] = true
+	}
+	if c.algorithm == config.CompressionZstd {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.encoder = encoder
+	}
+	return c, nil
+}
+
+// compress replaces the payload of the message of provided class with its compressed form, if this reduces its size.
+func (c *payloadCompressor) compress(class string, msg *message.Message) {
+	if !c.classes[class] || len(msg.Payload) < c.threshold {
+		return
+	}
+
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	if !ok {
+		return
+	}
+
+	var compressed []byte
+	if c.encoder != nil {
+		compressed = c.encoder.EncodeAll(msg.Payload, nil)
+	} else {
+		var buff bytes.Buffer
+		writer := gzip.NewWriter(&buff)
+		if _, err := writer.Write(msg.Payload); err != nil {
+			return
+		}
+		if err := writer.Close(); err != nil {
+			return
+		}
+		compressed = buff.Bytes()
+	}
+
+	ratio := float64(len(msg.Payload)) / float64(len(compressed))
+	c.logger.Debug("Compressed message payload", watermill.LogFields{
+		"topic":      topic,
+		"algorithm":  c.algorithm,
+		"original":   len(msg.Payload),
+		"compressed": len(compressed),
+		"ratio":      fmt.Sprintf("%.2f", ratio),
+	})
+
+	if len(compressed) >= len(msg.Payload) {
+		return
+	}
+
+	msg.Payload = compressed
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), topic+"/"+c.algorithm))
+}
+
+// close releases the resources of the zstd encoder, if any.
+func (c *payloadCompressor) close() error {
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+	return nil
+}
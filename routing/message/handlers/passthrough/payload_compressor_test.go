@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressGzipTelemetry(t *testing.T) {
+	settings := settings()
+	settings.Compression = config.CompressionGzip
+	settings.CompressionClasses = config.MessageClassTelemetry
+	settings.CompressionThreshold = 64
+
+	payload := largeEventPayload()
+	topic, compressed := requireValidMessageSettings(t, settings, "t", payload)
+	assert.Equal(t, "telemetry/test-tenant-id/test:device/gzip", topic)
+
+	reader, err := gzip.NewReader(bytes.NewReader([]byte(compressed)))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(decompressed), `"path":"/features/meter/properties/x"`)
+
+	// Events are not configured to be compressed.
+	topic, uncompressed := requireValidMessageSettings(t, settings, "e", payload)
+	assert.Equal(t, "event/test-tenant-id/test:device", topic)
+	assert.Contains(t, uncompressed, `"path":"/features/meter/properties/x"`)
+}
+
+func TestCompressZstd(t *testing.T) {
+	compressor, err := newPayloadCompressor(&config.CompressionSettings{
+		Compression:        config.CompressionZstd,
+		CompressionClasses: "telemetry, events",
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	payload := []byte(largeEventPayload())
+	msg := message.NewMessage("test", payload)
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), "event/tenant/device"))
+	compressor.compress(config.MessageClassEvents, msg)
+
+	topic, _ := connector.TopicFromCtx(msg.Context())
+	assert.Equal(t, "event/tenant/device/zstd", topic)
+
+	decoder, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	decompressed, err := decoder.DecodeAll(msg.Payload, nil)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decompressed)
+	assert.NoError(t, compressor.close())
+}
+
+func TestCompressBelowThreshold(t *testing.T) {
+	compressor, err := newPayloadCompressor(&config.CompressionSettings{
+		Compression:          config.CompressionGzip,
+		CompressionClasses:   config.MessageClassTelemetry,
+		CompressionThreshold: 1024,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	msg := message.NewMessage("test", []byte(telemetryPayload))
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), "telemetry/tenant/device"))
+	compressor.compress(config.MessageClassTelemetry, msg)
+
+	topic, _ := connector.TopicFromCtx(msg.Context())
+	assert.Equal(t, "telemetry/tenant/device", topic)
+	assert.Equal(t, telemetryPayload, string(msg.Payload))
+}
+
+func largeEventPayload() string {
+	return `{
+		"topic":"test/device/things/twin/events/modified",
+		"path":"/features/meter/properties/x",
+		"value":"` + strings.Repeat("value", 100) + `"
+	}`
+}
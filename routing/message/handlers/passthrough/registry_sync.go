@@ -0,0 +1,259 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+const (
+	// AWS IoT Basic Ingest topics of the registry rule, in format $aws/rules/<ruleName>/<request>.
+	topicRegistryRule        = "$aws/rules/%s/%s"
+	registryAttributesUpdate = "attributes"
+	registryGroupsUpdate     = "thing-groups"
+
+	attributesPath = "attributes"
+)
+
+// registryAttributes represents the registry rule request updating the AWS IoT registry attributes of a thing,
+// the removed attributes have empty values.
+type registryAttributes struct {
+	ThingName  string            `json:"thingName"`
+	ThingID    string            `json:"thingId"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// registryGroups represents the registry rule request updating the AWS IoT thing groups membership of a thing.
+type registryGroups struct {
+	ThingName   string   `json:"thingName"`
+	ThingID     string   `json:"thingId"`
+	ThingGroups []string `json:"thingGroups"`
+}
+
+// registrySync converts the changes of the selected Ditto thing attributes to AWS IoT registry updates. The last synced
+// values are kept per thing, so that only the changed attributes are sent.
+type registrySync struct {
+	attributes map[string]bool
+	rule       string
+	qos        connector.Qos
+	logger     watermill.LoggerAdapter
+
+	mutex  sync.Mutex
+	synced map[string]map[string]string
+}
+
+func newRegistrySync(settings *config.RegistrySettings, qos connector.Qos, logger watermill.LoggerAdapter) *registrySync {
+	attributes := make(map[string]bool)
+	for _, name := range settings.RegistryAttributes {
+		attributes[name] = true
+	}
+	return &registrySync{
+		attributes: attributes,
+		rule:       settings.RegistryRule,
+		qos:        qos,
+		logger:     logger,
+		synced:     make(map[string]map[string]string),
+	}
+}
+
+// toRegistryMessages converts the changes of the selected attributes of the device or, in gateway mode, of its child things
+// to AWS IoT registry update messages.
+func (h *deviceHandler) toRegistryMessages(env *protocol.Envelope) []*message.Message {
+	if h.registry == nil || !h.isShadowMessage(env) {
+		return nil
+	}
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	if thingID != h.deviceID && !h.gateway.GatewayMode {
+		// The child things are not represented by AWS IoT things.
+		return nil
+	}
+	return h.registry.sync(thingID, h.thingName(thingID), env)
+}
+
+// sync returns the registry update messages of the attributes changed by the provided Ditto twin command.
+func (s *registrySync) sync(thingID, thingName string, env *protocol.Envelope) []*message.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(strings.Trim(env.Path, "/")) == 0 && env.Topic.Action == protocol.ActionDelete {
+		// The AWS IoT thing is not changed on the deletion of the entire thing.
+		delete(s.synced, thingID)
+		return nil
+	}
+	values, ok := s.attributeValues(env)
+	if !ok {
+		return nil
+	}
+
+	synced, ok := s.synced[thingID]
+	if !ok {
+		synced = make(map[string]string)
+		s.synced[thingID] = synced
+	}
+	changed := make(map[string]string)
+	for name, value := range values {
+		previous, ok := synced[name]
+		if previous == value || (!ok && len(value) == 0) {
+			continue
+		}
+		changed[name] = value
+		if len(value) == 0 {
+			delete(synced, name)
+		} else {
+			synced[name] = value
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return s.toRuleMessages(thingID, thingName, changed)
+}
+
+// toRuleMessages returns the registry rule requests of the changed attributes and thing groups membership.
+func (s *registrySync) toRuleMessages(thingID, thingName string, changed map[string]string) []*message.Message {
+	var messages []*message.Message
+	if groups, ok := changed[config.ThingGroupsAttribute]; ok {
+		delete(changed, config.ThingGroupsAttribute)
+		request := &registryGroups{ThingName: thingName, ThingID: thingID, ThingGroups: []string{}}
+		if len(groups) > 0 {
+			request.ThingGroups = strings.Split(groups, ",")
+		}
+		topic := fmt.Sprintf(topicRegistryRule, s.rule, registryGroupsUpdate)
+		if msg, ok := s.newMessage(topic, request); ok {
+			messages = append(messages, msg)
+		}
+	}
+	if len(changed) > 0 {
+		request := &registryAttributes{ThingName: thingName, ThingID: thingID, Attributes: changed}
+		topic := fmt.Sprintf(topicRegistryRule, s.rule, registryAttributesUpdate)
+		if msg, ok := s.newMessage(topic, request); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func (s *registrySync) newMessage(topic string, payload interface{}) (*message.Message, bool) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Error("Cannot create registry update", err, watermill.LogFields{"topic": topic})
+		return nil, false
+	}
+	msg := message.NewMessage(watermill.NewUUID(), data)
+	msg.SetContext(connector.SetQosToCtx(connector.SetTopicToCtx(msg.Context(), topic), s.qos))
+	return msg, true
+}
+
+// attributeValues returns the values of the selected attributes modified by the provided Ditto twin command,
+// the deleted attributes have empty values.
+func (s *registrySync) attributeValues(env *protocol.Envelope) (map[string]string, bool) {
+	path := strings.Trim(env.Path, "/")
+	merge := env.Topic.Action == protocol.ActionMerge
+	switch {
+	case len(path) == 0:
+		thing, ok := env.Value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, ok := thing[attributesPath]; !ok && merge {
+			return nil, false
+		}
+		return s.objectValues(thing[attributesPath], merge), true
+
+	case path == attributesPath:
+		if env.Topic.Action == protocol.ActionDelete {
+			return s.objectValues(nil, false), true
+		}
+		return s.objectValues(env.Value, merge), true
+
+	case strings.HasPrefix(path, attributesPath+"/"):
+		name := path[len(attributesPath)+1:]
+		if !s.attributes[name] {
+			// Not selected attribute, the nested attribute paths are not supported.
+			return nil, false
+		}
+		if env.Topic.Action == protocol.ActionDelete {
+			return map[string]string{name: ""}, true
+		}
+		return map[string]string{name: registryValue(name, env.Value)}, true
+	}
+	return nil, false
+}
+
+// objectValues returns the values of the selected attributes of the provided attributes object. The selected attributes
+// missing in the object are deleted, unless merged.
+func (s *registrySync) objectValues(object interface{}, merge bool) map[string]string {
+	attributes, _ := object.(map[string]interface{})
+	values := make(map[string]string)
+	for name := range s.attributes {
+		value, ok := attributes[name]
+		if !ok && merge {
+			continue
+		}
+		values[name] = registryValue(name, value)
+	}
+	return values
+}
+
+// registryValue converts the provided attribute value to its AWS IoT registry value, the thing groups are joined with commas.
+func registryValue(name string, value interface{}) string {
+	if name == config.ThingGroupsAttribute {
+		return thingGroups(value)
+	}
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+// thingGroups returns the sorted thing groups of the provided thingGroups attribute value, either an array or a comma separated string.
+func thingGroups(value interface{}) string {
+	var groups []string
+	switch v := value.(type) {
+	case string:
+		groups = strings.Split(v, ",")
+	case []interface{}:
+		for _, group := range v {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	}
+	result := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			result = append(result, group)
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrySyncRule(t *testing.T) {
+	settings := settings()
+	settings.RegistryAttributes = config.AttributeNamesType{"serial", "model", config.ThingGroupsAttribute}
+	settings.RegistryRule = "registry"
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	create := `{"topic":"test/device/things/twin/commands/create","path":"/","value":{"attributes":{"serial":"S1","model":{"rev":1},"floor":1,"thingGroups":["b","a"]}}}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/thing-groups": `{"thingName":"test:device","thingId":"test:device","thingGroups":["a","b"]}`,
+		"$aws/rules/registry/attributes":   `{"thingName":"test:device","thingId":"test:device","attributes":{"model":"{\"rev\":1}","serial":"S1"}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, create))
+
+	unchanged := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/serial","value":"S1"}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, unchanged))
+	notSelected := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/floor","value":2}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, notSelected))
+	nested := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/model/rev","value":2}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, nested))
+
+	modify := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/serial","value":"S2"}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/attributes": `{"thingName":"test:device","thingId":"test:device","attributes":{"serial":"S2"}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, modify))
+
+	merge := `{"topic":"test/device/things/twin/commands/merge","path":"/attributes","value":{"model":null,"floor":3}}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/attributes": `{"thingName":"test:device","thingId":"test:device","attributes":{"model":""}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, merge))
+
+	groups := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes/thingGroups","value":"a, c"}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/thing-groups": `{"thingName":"test:device","thingId":"test:device","thingGroups":["a","c"]}`,
+	}, registryMessages(t, messageHandler.HandleMessage, groups))
+
+	deleted := `{"topic":"test/device/things/twin/commands/delete","path":"/attributes/thingGroups"}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/thing-groups": `{"thingName":"test:device","thingId":"test:device","thingGroups":[]}`,
+	}, registryMessages(t, messageHandler.HandleMessage, deleted))
+
+	// replaced attributes
+	replaced := `{"topic":"test/device/things/twin/commands/modify","path":"/attributes","value":{"model":"M1"}}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/attributes": `{"thingName":"test:device","thingId":"test:device","attributes":{"model":"M1","serial":""}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, replaced))
+
+	// child things are not represented by AWS IoT things
+	child := `{"topic":"test/device:door/things/twin/commands/modify","path":"/attributes/serial","value":"D1"}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, child))
+	// not a twin command
+	event := `{"topic":"test/device/things/twin/events/modified","path":"/attributes/serial","value":"S3"}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, event))
+}
+
+func TestRegistrySyncGatewayMode(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	settings.ChildThingNameTemplate = "{childId}"
+	settings.RegistryAttributes = config.AttributeNamesType{"serial", config.ThingGroupsAttribute}
+	settings.RegistryRule = "registry"
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	create := `{"topic":"test/device:door/things/twin/commands/create","path":"/","value":{"attributes":{"serial":"D1","thingGroups":["doors"]}}}`
+	created := map[string]string{
+		"$aws/rules/registry/thing-groups": `{"thingName":"door","thingId":"test:device:door","thingGroups":["doors"]}`,
+		"$aws/rules/registry/attributes":   `{"thingName":"door","thingId":"test:device:door","attributes":{"serial":"D1"}}`,
+	}
+	assert.Equal(t, created, registryMessages(t, messageHandler.HandleMessage, create))
+
+	modify := `{"topic":"test/device:door/things/twin/commands/merge","path":"/","value":{"attributes":{"serial":"D2"}}}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/attributes": `{"thingName":"door","thingId":"test:device:door","attributes":{"serial":"D2"}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, modify))
+
+	features := `{"topic":"test/device:door/things/twin/commands/merge","path":"/","value":{"features":{}}}`
+	assert.Empty(t, registryMessages(t, messageHandler.HandleMessage, features))
+
+	// the synced attributes are forgotten on the thing deletion
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/delete","path":"/"}`)
+	assert.Equal(t, created, registryMessages(t, messageHandler.HandleMessage, create))
+}
+
+func TestRegistrySyncTopicFilters(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	settings.ChildThingNameTemplate = "{childId}"
+	settings.RegistryAttributes = config.AttributeNamesType{"serial"}
+	settings.RegistryRule = "registry"
+	settings.TopicFilters = []config.TopicFilterRule{
+		{Action: config.TopicFilterDeny, Topic: "^test/device:door/"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	// the filtered messages are not synced
+	denied := `{"topic":"test/device:door/things/twin/commands/modify","path":"/attributes/serial","value":"D1"}`
+	assert.Empty(t, handle(t, messageHandler.HandleMessage, "e", denied))
+
+	allowed := `{"topic":"test/device:window/things/twin/commands/modify","path":"/attributes/serial","value":"W1"}`
+	assert.Equal(t, map[string]string{
+		"$aws/rules/registry/attributes": `{"thingName":"window","thingId":"test:device:window","attributes":{"serial":"W1"}}`,
+	}, registryMessages(t, messageHandler.HandleMessage, allowed))
+}
+
+func registryMessages(t *testing.T, h message.HandlerFunc, payload string) map[string]string {
+	result := make(map[string]string)
+	for _, msg := range handle(t, h, "e", payload) {
+		topic, ok := connector.TopicFromCtx(msg.Context())
+		require.True(t, ok)
+		if strings.HasPrefix(topic, "$aws/rules/") {
+			result[topic] = string(msg.Payload)
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// isRouted returns true if the Ditto message satisfies all route conditions of its message class.
+// Conditions which cannot be evaluated are logged and exclude the message.
+func (h *deviceHandler) isRouted(class string, env *protocol.Envelope) bool {
+	if len(h.routeConditions) == 0 {
+		return true
+	}
+
+	data := &config.ConditionEnv{
+		Class:      class,
+		Topic:      env.Topic.String(),
+		ThingID:    fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName),
+		Namespace:  env.Topic.Namespace,
+		EntityName: env.Topic.EntityName,
+		Channel:    string(env.Topic.Channel),
+		Criterion:  string(env.Topic.Criterion),
+		Action:     string(env.Topic.Action),
+		Feature:    featureFromPath(env.Path),
+		Path:       env.Path,
+		Value:      env.Value,
+	}
+	if env.Topic.Criterion == protocol.CriterionMessages {
+		data.Subject = string(env.Topic.Action)
+	}
+	if env.Headers != nil {
+		data.Headers = env.Headers.Values
+	}
+
+	for i := range h.routeConditions {
+		rule := &h.routeConditions[i]
+		if !rule.Matches(class) {
+			continue
+		}
+		routed, err := rule.Evaluate(data)
+		if err != nil {
+			h.logger.Error("Excluded message by route condition evaluation failure", err, watermill.LogFields{
+				"handler_name": h.Name(),
+				"name":         rule.Name,
+				"condition":    rule.Condition,
+				"topic":        data.Topic,
+			})
+			return false
+		}
+		if !routed {
+			h.Debug("Excluded message by route condition", map[string]interface{}{
+				"name":  rule.Name,
+				"topic": data.Topic,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// messageClass returns the message class of the Ditto message received on the provided local message.
+func (h *deviceHandler) messageClass(env *protocol.Envelope, msg *message.Message) string {
+	if h.isShadowMessage(env) {
+		return config.MessageClassShadow
+	}
+	topic, _ := connector.TopicFromCtx(msg.Context())
+	if prefix := strings.SplitN(topic, "/", 2)[0]; prefix == "t" || prefix == "telemetry" {
+		return config.MessageClassTelemetry
+	}
+	return config.MessageClassEvents
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteConditions(t *testing.T) {
+	settings := settings()
+	settings.RouteConditions = []config.RouteCondition{
+		{Name: "severity", Class: config.MessageClassEvents, Condition: `subject != "alarm" or value.severity >= 3`},
+		{Name: "temperature", Class: config.MessageClassTelemetry, Condition: `feature != "climate" or value.temperature >= 0.5`},
+		{Name: "shadow", Class: config.MessageClassShadow, Condition: `headers["x-shadow"] != false`},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	alarm := `{"topic":"test/device/things/live/messages/alarm","path":"/outbox/messages/alarm","value":{"severity":%d}}`
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(alarm, 2))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(alarm, 3))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "t", fmt.Sprintf(alarm, 2))))
+
+	climate := `{"topic":"test/device/things/twin/events/modified","path":"/features/climate/properties","value":{"temperature":%v}}`
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "telemetry", fmt.Sprintf(climate, 0.1))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "telemetry", fmt.Sprintf(climate, 0.7))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "event", fmt.Sprintf(climate, 0.1))))
+
+	shadow := `{"topic":"test/device/things/twin/commands/create","headers":{"x-shadow":%v},"path":"/features/climate","value":{"properties":{"temperature":1}}}`
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, false))))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", fmt.Sprintf(shadow, true))))
+
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", `{"unknown":true}`)))
+}
+
+func TestRouteConditionEvaluationError(t *testing.T) {
+	settings := settings()
+	settings.RouteConditions = []config.RouteCondition{{Condition: `value.temperature > 0`}}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	assert.Equal(t, 0, len(handleTelemetry(t, messageHandler.HandleMessage)))
+}
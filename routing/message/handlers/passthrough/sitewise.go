@@ -0,0 +1,254 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+const siteWiseQualityGood = "GOOD"
+
+// siteWiseEntry is the AWS IoT SiteWise message with the values of a single property alias.
+type siteWiseEntry struct {
+	PropertyAlias  string          `json:"propertyAlias"`
+	PropertyValues []siteWiseValue `json:"propertyValues"`
+}
+
+type siteWiseValue struct {
+	Value     map[string]interface{} `json:"value"`
+	Timestamp siteWiseTimestamp      `json:"timestamp"`
+	Quality   string                 `json:"quality"`
+}
+
+type siteWiseTimestamp struct {
+	TimeInSeconds int64 `json:"timeInSeconds"`
+	OffsetInNanos int64 `json:"offsetInNanos"`
+}
+
+// siteWiseConverter groups the SiteWise property values per alias within a time window.
+type siteWiseConverter struct {
+	topic  string
+	window time.Duration
+	qos    connector.Qos
+	logger watermill.LoggerAdapter
+
+	mutex   sync.Mutex
+	pub     message.Publisher
+	pending map[string]*siteWiseEntry
+	timer   *time.Timer
+}
+
+func newSiteWiseConverter(topic string, window time.Duration, qos connector.Qos, logger watermill.LoggerAdapter) *siteWiseConverter {
+	return &siteWiseConverter{
+		topic:   topic,
+		window:  window,
+		qos:     qos,
+		logger:  logger,
+		pending: make(map[string]*siteWiseEntry),
+	}
+}
+
+// setPublisher sets the publisher used for the property values flushed on time window expiration.
+func (c *siteWiseConverter) setPublisher(pub message.Publisher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pub = pub
+}
+
+// add adds the property values to their aliases and returns the SiteWise messages if no time window is configured.
+func (c *siteWiseConverter) add(entries map[string][]siteWiseValue) []*message.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for alias, values := range entries {
+		entry, ok := c.pending[alias]
+		if !ok {
+			entry = &siteWiseEntry{PropertyAlias: alias}
+			c.pending[alias] = entry
+		}
+		entry.PropertyValues = append(entry.PropertyValues, values...)
+	}
+
+	if c.window <= 0 {
+		return c.flush()
+	}
+	if c.timer == nil && len(c.pending) > 0 {
+		c.timer = time.AfterFunc(c.window, c.flushExpired)
+	}
+	return []*message.Message{}
+}
+
+// flushExpired publishes the property values on time window expiration.
+func (c *siteWiseConverter) flushExpired() {
+	c.mutex.Lock()
+	c.timer = nil
+	messages := c.flush()
+	pub := c.pub
+	c.mutex.Unlock()
+
+	if len(messages) == 0 {
+		return
+	}
+	if pub == nil {
+		c.logger.Error("Cannot publish SiteWise property values, no publisher", nil, watermill.LogFields{"topic": c.topic})
+		return
+	}
+	if err := pub.Publish(c.topic, messages...); err != nil {
+		c.logger.Error("Failed to publish SiteWise property values", err, watermill.LogFields{"topic": c.topic})
+	}
+}
+
+// flush returns a SiteWise message per property alias, sorted by alias.
+func (c *siteWiseConverter) flush() []*message.Message {
+	aliases := make([]string, 0, len(c.pending))
+	for alias := range c.pending {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	messages := make([]*message.Message, 0, len(aliases))
+	for _, alias := range aliases {
+		payload, _ := json.Marshal(c.pending[alias])
+
+		c.logger.Debug("Send SiteWise property values", watermill.LogFields{
+			"topic": c.topic,
+			"alias": alias,
+			"count": len(c.pending[alias].PropertyValues),
+		})
+
+		msg := message.NewMessage(watermill.NewUUID(), payload)
+		ctx := connector.SetQosToCtx(connector.SetTopicToCtx(context.Background(), c.topic), c.qos)
+		msg.SetContext(handlers.SetPriorityToCtx(ctx, handlers.PriorityLow))
+		messages = append(messages, msg)
+	}
+	c.pending = make(map[string]*siteWiseEntry)
+	return messages
+}
+
+// toSiteWiseMessages converts the feature properties of the telemetry message to SiteWise property values.
+// Returns false if the message does not contain any feature property.
+func (h *deviceHandler) toSiteWiseMessages(env *protocol.Envelope, msg *message.Message) ([]*message.Message, bool) {
+	topic, _ := connector.TopicFromCtx(msg.Context())
+
+	// Decode the numbers of the message payload, which includes the timestamp header, to distinguish integer values.
+	var data struct {
+		Path    string                 `json:"path"`
+		Value   interface{}            `json:"value"`
+		Headers map[string]interface{} `json:"headers"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(msg.Payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, false
+	}
+
+	timestamp := toSiteWiseTimestamp(data.Headers[headerTimestamp])
+	entries := map[string][]siteWiseValue{}
+	values := h.templateValues(config.MessageClassTelemetry, topic, env)
+
+	search(valueFeaturesTag, integrate(strings.Split(data.Path, "/"), data.Value), func(features map[string]interface{}) {
+		for featureID, feature := range features {
+			search(valuePropertiesTag, feature, func(properties map[string]interface{}) {
+				flatten("", properties, func(property string, value interface{}) {
+					typed, ok := toSiteWiseValue(value)
+					if !ok {
+						return
+					}
+					values[config.PlaceholderFeature] = featureID
+					values[config.PlaceholderProperty] = property
+					alias := config.ExpandTemplate(h.siteWiseAliasTemplate, values)
+					entries[alias] = append(entries[alias], siteWiseValue{
+						Value:     typed,
+						Timestamp: timestamp,
+						Quality:   siteWiseQualityGood,
+					})
+				})
+			})
+		}
+	})
+
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return h.siteWise.add(entries), true
+}
+
+// flatten calls the provided function for each leaf value of the JSON data with its slash separated path.
+func flatten(path string, data interface{}, fn func(string, interface{})) {
+	if object, ok := data.(map[string]interface{}); ok {
+		for key, value := range object {
+			if len(path) > 0 {
+				flatten(path+"/"+key, value, fn)
+			} else {
+				flatten(key, value, fn)
+			}
+		}
+		return
+	}
+	fn(path, data)
+}
+
+// toSiteWiseValue returns the SiteWise typed value of the provided JSON value, null values are not supported.
+func toSiteWiseValue(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case json.Number:
+		// The SiteWise integer values are 32-bit, the other numbers are sent as double values.
+		if i, err := v.Int64(); err == nil && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return map[string]interface{}{"integerValue": i}, true
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, false
+		}
+		return map[string]interface{}{"doubleValue": f}, true
+	case bool:
+		return map[string]interface{}{"booleanValue": v}, true
+	case string:
+		return map[string]interface{}{"stringValue": v}, true
+	default:
+		raw, _ := json.Marshal(v)
+		return map[string]interface{}{"stringValue": string(raw)}, true
+	}
+}
+
+// toSiteWiseTimestamp converts the timestamp header in milliseconds to a SiteWise timestamp, current time is used if missing.
+func toSiteWiseTimestamp(header interface{}) siteWiseTimestamp {
+	timestamp := time.Now()
+	if number, ok := header.(json.Number); ok {
+		if millis, err := number.Int64(); err == nil {
+			timestamp = time.UnixMilli(millis)
+		}
+	}
+	return siteWiseTimestamp{
+		TimeInSeconds: timestamp.Unix(),
+		OffsetInNanos: int64(timestamp.Nanosecond()),
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteWiseTypedValues(t *testing.T) {
+	settings := siteWiseSettings()
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	payload := `{
+		"topic":"test/device/things/twin/events/modified",
+		"path":"/features/meter",
+		"value":{"properties":{"count":3,"power":12.5,"on":true,"unit":"kW","range":[1,2],"missing":null,"total":2147483648,"min":-2147483648}}
+	}`
+	messages := handle(t, messageHandler.HandleMessage, "t", payload)
+	require.Equal(t, 7, len(messages))
+
+	expected := []struct {
+		alias string
+		value map[string]interface{}
+	}{
+		{"/test/device/meter/count", map[string]interface{}{"integerValue": float64(3)}},
+		{"/test/device/meter/min", map[string]interface{}{"integerValue": float64(-2147483648)}},
+		{"/test/device/meter/on", map[string]interface{}{"booleanValue": true}},
+		{"/test/device/meter/power", map[string]interface{}{"doubleValue": 12.5}},
+		{"/test/device/meter/range", map[string]interface{}{"stringValue": "[1,2]"}},
+		{"/test/device/meter/total", map[string]interface{}{"doubleValue": float64(2147483648)}},
+		{"/test/device/meter/unit", map[string]interface{}{"stringValue": "kW"}},
+	}
+	for i, exp := range expected {
+		topic, ok := connector.TopicFromCtx(messages[i].Context())
+		require.True(t, ok)
+		assert.Equal(t, "sitewise/ingest", topic)
+
+		entry := siteWiseEntry{}
+		require.NoError(t, json.Unmarshal(messages[i].Payload, &entry))
+		assert.Equal(t, exp.alias, entry.PropertyAlias)
+		require.Equal(t, 1, len(entry.PropertyValues))
+		assert.Equal(t, exp.value, entry.PropertyValues[0].Value)
+		assert.Equal(t, siteWiseQualityGood, entry.PropertyValues[0].Quality)
+		assert.InDelta(t, time.Now().Unix(), entry.PropertyValues[0].Timestamp.TimeInSeconds, 5)
+	}
+}
+
+func TestSiteWiseAliasTemplate(t *testing.T) {
+	settings := siteWiseSettings()
+	settings.SiteWiseAliasTemplate = "{deviceId}/{feature}/{property}"
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	payload := `{
+		"topic":"test/device/things/twin/events/modified",
+		"path":"/features/meter/properties/x",
+		"value":{"power":12.5}
+	}`
+	messages := handle(t, messageHandler.HandleMessage, "t", payload)
+	require.Equal(t, 1, len(messages))
+
+	entry := siteWiseEntry{}
+	require.NoError(t, json.Unmarshal(messages[0].Payload, &entry))
+	assert.Equal(t, "test:device/meter/x/power", entry.PropertyAlias)
+}
+
+func TestSiteWiseNotConverted(t *testing.T) {
+	settings := siteWiseSettings()
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	attributes := `{"topic":"test/device/things/twin/events/modified","path":"/attributes/x","value":1}`
+	messages := handle(t, messageHandler.HandleMessage, "t", attributes)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "telemetry/test-tenant-id/test:device")
+
+	messages = handle(t, messageHandler.HandleMessage, "e", telemetryPayload)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/test:device")
+}
+
+func TestSiteWiseWindow(t *testing.T) {
+	settings := siteWiseSettings()
+	settings.SiteWiseWindow = 50
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	pub := &recordingPublisher{}
+	messageHandler.(*deviceHandler).SetPublisher(pub)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 0, len(handleTelemetry(t, messageHandler.HandleMessage)))
+	}
+
+	require.Eventually(t, func() bool {
+		return pub.count() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	entry := siteWiseEntry{}
+	require.NoError(t, json.Unmarshal(pub.messages[0].Payload, &entry))
+	assert.Equal(t, "/test/device/meter/x", entry.PropertyAlias)
+	assert.Equal(t, 3, len(entry.PropertyValues))
+}
+
+func siteWiseSettings() *config.CloudSettings {
+	settings := settings()
+	settings.SiteWiseTopic = "sitewise/ingest"
+	settings.SiteWiseAliasTemplate = config.DefaultSiteWiseAliasTemplate
+	return settings
+}
+
+func handle(t *testing.T, h message.HandlerFunc, topic string, payload string) []*message.Message {
+	msg := &message.Message{Payload: []byte(payload)}
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), topic))
+
+	messages, err := h(msg)
+	require.NoError(t, err)
+	return messages
+}
+
+func assertMessageTopic(t *testing.T, msg *message.Message, expected string) {
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	require.True(t, ok)
+	assert.Equal(t, expected, topic)
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// telemetryBatch is the envelope of the batched telemetry messages published toward AWS IoT.
+type telemetryBatch struct {
+	ThingID   string            `json:"thingId"`
+	FeatureID string            `json:"featureId,omitempty"`
+	Count     int               `json:"count"`
+	Messages  []json.RawMessage `json:"messages"`
+}
+
+type pendingBatch struct {
+	topic string
+	batch telemetryBatch
+	size  int
+	timer *time.Timer
+}
+
+// telemetryBatcher groups the telemetry messages per topic, thing and feature within a time window or a byte size.
+type telemetryBatcher struct {
+	window     time.Duration
+	maxBytes   int
+	qos        connector.Qos
+	compressor *payloadCompressor
+	logger     watermill.LoggerAdapter
+
+	mutex   sync.Mutex
+	pub     message.Publisher
+	batches map[string]*pendingBatch
+}
+
+func newTelemetryBatcher(window time.Duration,
+	maxBytes int,
+	qos connector.Qos,
+	compressor *payloadCompressor,
+	logger watermill.LoggerAdapter,
+) *telemetryBatcher {
+	return &telemetryBatcher{
+		window:     window,
+		maxBytes:   maxBytes,
+		qos:        qos,
+		compressor: compressor,
+		logger:     logger,
+		batches:    make(map[string]*pendingBatch),
+	}
+}
+
+// setPublisher sets the publisher used for the batches flushed on time window expiration.
+func (b *telemetryBatcher) setPublisher(pub message.Publisher) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.pub = pub
+}
+
+// add adds the telemetry message to its batch and returns the batch message if its maximum byte size is reached.
+func (b *telemetryBatcher) add(env *protocol.Envelope, msg *message.Message) []*message.Message {
+	topic, _ := connector.TopicFromCtx(msg.Context())
+	thingID := fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+	featureID := featureFromPath(env.Path)
+	key := strings.Join([]string{topic, thingID, featureID}, "|")
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	pending, ok := b.batches[key]
+	if !ok {
+		pending = &pendingBatch{
+			topic: topic,
+			batch: telemetryBatch{ThingID: thingID, FeatureID: featureID},
+		}
+		b.batches[key] = pending
+		if b.window > 0 {
+			pending.timer = time.AfterFunc(b.window, func() {
+				b.flushExpired(key, pending)
+			})
+		}
+	}
+	pending.batch.Messages = append(pending.batch.Messages, json.RawMessage(msg.Payload))
+	pending.batch.Count++
+	pending.size += len(msg.Payload)
+
+	if b.maxBytes > 0 && pending.size >= b.maxBytes {
+		b.remove(key, pending)
+		return []*message.Message{b.toMessage(pending)}
+	}
+	return []*message.Message{}
+}
+
+// flushExpired publishes the batch on its time window expiration.
+func (b *telemetryBatcher) flushExpired(key string, pending *pendingBatch) {
+	b.mutex.Lock()
+	if current, ok := b.batches[key]; !ok || current != pending {
+		b.mutex.Unlock()
+		return
+	}
+	b.remove(key, pending)
+	pub := b.pub
+	b.mutex.Unlock()
+
+	b.publish(pub, pending)
+}
+
+// flush publishes all pending batches, e.g. on shutdown.
+func (b *telemetryBatcher) flush() {
+	b.mutex.Lock()
+	keys := make([]string, 0, len(b.batches))
+	for key := range b.batches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	batches := make([]*pendingBatch, 0, len(keys))
+	for _, key := range keys {
+		batches = append(batches, b.batches[key])
+		b.remove(key, b.batches[key])
+	}
+	pub := b.pub
+	b.mutex.Unlock()
+
+	for _, pending := range batches {
+		b.publish(pub, pending)
+	}
+}
+
+func (b *telemetryBatcher) publish(pub message.Publisher, pending *pendingBatch) {
+	msg := b.toMessage(pending)
+	if pub == nil {
+		b.logger.Error("Cannot publish telemetry batch, no publisher", nil, watermill.LogFields{"topic": pending.topic})
+		return
+	}
+	if err := pub.Publish(pending.topic, msg); err != nil {
+		b.logger.Error("Failed to publish telemetry batch", err, watermill.LogFields{"topic": pending.topic})
+	}
+}
+
+func (b *telemetryBatcher) remove(key string, pending *pendingBatch) {
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	delete(b.batches, key)
+}
+
+func (b *telemetryBatcher) toMessage(pending *pendingBatch) *message.Message {
+	payload, _ := json.Marshal(pending.batch)
+
+	b.logger.Debug("Send telemetry batch", watermill.LogFields{
+		"topic": pending.topic,
+		"count": pending.batch.Count,
+		"bytes": len(payload),
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	ctx := connector.SetQosToCtx(connector.SetTopicToCtx(context.Background(), pending.topic), b.qos)
+	msg.SetContext(handlers.SetPriorityToCtx(ctx, handlers.PriorityLow))
+	if b.compressor != nil {
+		b.compressor.compress(config.MessageClassTelemetry, msg)
+	}
+	return msg
+}
+
+// featureFromPath returns the feature ID of a Ditto path in format /features/<featureId>/...
+func featureFromPath(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > 1 && segments[0] == valueFeaturesTag {
+		return segments[1]
+	}
+	return ""
+}
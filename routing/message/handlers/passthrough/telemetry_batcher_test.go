@@ -0,0 +1,160 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse-kanto/aws-connector/routing/message/handlers"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const telemetryPayload = `{
+	"topic":"test/device/things/twin/events/modified",
+	"path":"/features/meter/properties/x",
+	"value":1
+}`
+
+type recordingPublisher struct {
+	mutex    sync.Mutex
+	messages []*message.Message
+}
+
+func (p *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func (p *recordingPublisher) count() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.messages)
+}
+
+func TestTelemetryBatchMaxBytes(t *testing.T) {
+	settings := settings()
+	settings.TelemetryBatchWindow = 60000
+	settings.TelemetryBatchMaxBytes = 2 * len(telemetryPayload)
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	messages := handleTelemetry(t, messageHandler.HandleMessage)
+	assert.Equal(t, 0, len(messages))
+
+	messages = handleTelemetry(t, messageHandler.HandleMessage)
+	require.Equal(t, 1, len(messages))
+
+	topic, ok := connector.TopicFromCtx(messages[0].Context())
+	require.True(t, ok)
+	assert.Equal(t, "telemetry/test-tenant-id/test:device", topic)
+
+	batch := telemetryBatch{}
+	require.NoError(t, json.Unmarshal(messages[0].Payload, &batch))
+	assert.Equal(t, "test:device", batch.ThingID)
+	assert.Equal(t, "meter", batch.FeatureID)
+	assert.Equal(t, 2, batch.Count)
+	assert.Equal(t, 2, len(batch.Messages))
+}
+
+func TestTelemetryBatchWindow(t *testing.T) {
+	settings := settings()
+	settings.TelemetryBatchWindow = 50
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	pub := &recordingPublisher{}
+	messageHandler.(*deviceHandler).SetPublisher(pub)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 0, len(handleTelemetry(t, messageHandler.HandleMessage)))
+	}
+
+	require.Eventually(t, func() bool {
+		return pub.count() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	batch := telemetryBatch{}
+	require.NoError(t, json.Unmarshal(pub.messages[0].Payload, &batch))
+	assert.Equal(t, 3, batch.Count)
+}
+
+func TestTelemetryBatchFlush(t *testing.T) {
+	settings := settings()
+	settings.TelemetryBatchWindow = 60000
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	pub := &recordingPublisher{}
+	messageHandler.(*deviceHandler).SetPublisher(pub)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 0, len(handleTelemetry(t, messageHandler.HandleMessage)))
+	}
+
+	messageHandler.(handlers.Flusher).Flush()
+	require.Equal(t, 1, pub.count())
+	batch := telemetryBatch{}
+	require.NoError(t, json.Unmarshal(pub.messages[0].Payload, &batch))
+	assert.Equal(t, 2, batch.Count)
+
+	messageHandler.(handlers.Flusher).Flush()
+	assert.Equal(t, 1, pub.count())
+}
+
+func TestTelemetryBatchEventsNotBatched(t *testing.T) {
+	settings := settings()
+	settings.TelemetryBatchWindow = 60000
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	msg := &message.Message{Payload: []byte(telemetryPayload)}
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), "e"))
+
+	messages, err := messageHandler.HandleMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(messages))
+}
+
+func TestFeatureFromPath(t *testing.T) {
+	assert.Equal(t, "meter", featureFromPath("/features/meter/properties/x"))
+	assert.Equal(t, "meter", featureFromPath("features/meter"))
+	assert.Equal(t, "", featureFromPath("/attributes/location"))
+	assert.Equal(t, "", featureFromPath("/features"))
+}
+
+func handleTelemetry(t *testing.T, h message.HandlerFunc) []*message.Message {
+	msg := &message.Message{Payload: []byte(telemetryPayload)}
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), "t"))
+
+	messages, err := h(msg)
+	require.NoError(t, err)
+	return messages
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import "github.com/ThreeDotsLabs/watermill/message"
+
+// ThingsObserver is notified on the creation and deletion of the things by the local applications
+type ThingsObserver interface {
+	// ThingCreated is called when the thing with the specified thingID is created
+	ThingCreated(thingID string)
+	// ThingDeleted is called when the thing with the specified thingID is deleted
+	ThingDeleted(thingID string)
+}
+
+// ThingsRegistry is a things observer that also registers the AWS IoT things of the created things
+type ThingsRegistry interface {
+	ThingsObserver
+	// ThingName returns the AWS IoT thing name of the thing with the specified thingID
+	ThingName(thingID string) string
+	// Hold holds the messages of the thing with the specified thingID until its AWS IoT thing is registered,
+	// returns false if the messages can be forwarded
+	Hold(thingID string, msgs []*message.Message) bool
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingThingsObserver struct {
+	created []string
+	deleted []string
+}
+
+func (o *recordingThingsObserver) ThingCreated(thingID string) {
+	o.created = append(o.created, thingID)
+}
+
+func (o *recordingThingsObserver) ThingDeleted(thingID string) {
+	o.deleted = append(o.deleted, thingID)
+}
+
+type holdingThingsRegistry struct {
+	recordingThingsObserver
+	held map[string][]*message.Message
+}
+
+func (r *holdingThingsRegistry) ThingName(thingID string) string {
+	if thingID == "test:device" {
+		return thingID
+	}
+	return "registered-" + thingID
+}
+
+func (r *holdingThingsRegistry) Hold(thingID string, msgs []*message.Message) bool {
+	if thingID != "test:device:door" {
+		return false
+	}
+	r.held[thingID] = append(r.held[thingID], msgs...)
+	return true
+}
+
+func TestThingsObserver(t *testing.T) {
+	observer := &recordingThingsObserver{}
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder, WithThingsObserver(observer))
+	require.NoError(t, messageHandler.Init(settings(), watermill.NopLogger{}))
+
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/create","path":"/","value":{"attributes":{"floor":1}}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:window/things/twin/events/created","path":"/","value":{}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/delete","path":"/"}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:window/things/twin/events/deleted","path":""}`)
+
+	// not a thing creation or deletion
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/create","path":"/features/lock","value":{}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/modify","path":"/","value":{}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/live/commands/create","path":"/","value":{}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/other/things/twin/commands/create","path":"/","value":{}}`)
+	handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/create","path":"/","status":201}`)
+
+	assert.Equal(t, []string{"test:device:door", "test:device:window"}, observer.created)
+	assert.Equal(t, []string{"test:device:door", "test:device:window"}, observer.deleted)
+}
+
+func TestThingsRegistry(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	settings.ChildThingNameTemplate = "{childId}"
+	settings.ChildRegistration = true
+
+	registry := &holdingThingsRegistry{held: make(map[string][]*message.Message)}
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder, WithThingsObserver(registry))
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	messages := handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/commands/create","path":"/","value":{"attributes":{"floor":1}}}`)
+	assert.Empty(t, messages)
+	assert.Equal(t, []string{"test:device:door"}, registry.created)
+	require.Equal(t, 1, len(registry.held["test:device:door"]))
+	assertMessageTopic(t, registry.held["test:device:door"][0], "$aws/things/registered-test:device:door/shadow/update")
+
+	messages = handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:window/things/twin/events/modified","path":"/features/lock/properties/x","value":1}`)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/registered-test:device:window")
+
+	messages = handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device/things/twin/events/modified","path":"/features/lock/properties/x","value":1}`)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/test:device")
+
+	// registration disabled
+	settings.ChildRegistration = false
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+	messages = handle(t, messageHandler.HandleMessage, "e", `{"topic":"test/device:door/things/twin/events/modified","path":"/features/lock/properties/x","value":1}`)
+	require.Equal(t, 1, len(messages))
+	assertMessageTopic(t, messages[0], "event/test-tenant-id/door")
+}
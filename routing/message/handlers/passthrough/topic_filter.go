@@ -0,0 +1,67 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"sync/atomic"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// topicFilter is a topic filter rule along with the number of messages it matched.
+type topicFilter struct {
+	rule config.TopicFilterRule
+	hits uint64
+}
+
+func newTopicFilters(rules []config.TopicFilterRule) []*topicFilter {
+	filters := make([]*topicFilter, len(rules))
+	for i, rule := range rules {
+		filters[i] = &topicFilter{rule: rule}
+	}
+	return filters
+}
+
+// isAllowed returns the action of the first topic filter rule matching the Ditto topic of the message.
+// Messages which are not Ditto messages are evaluated by their local MQTT topic instead, so that they cannot
+// bypass the deny rules. Messages not matching any rule are allowed.
+func (h *deviceHandler) isAllowed(env *protocol.Envelope, msg *message.Message) bool {
+	if len(h.topicFilters) == 0 {
+		return true
+	}
+
+	var topic string
+	if env != nil {
+		topic = env.Topic.String()
+	} else {
+		topic, _ = connector.TopicFromCtx(msg.Context())
+	}
+	for i, filter := range h.topicFilters {
+		if filter.rule.Matches(topic) {
+			hits := atomic.AddUint64(&filter.hits, 1)
+			h.Debug("Matched topic filter", map[string]interface{}{
+				"topic":   topic,
+				"rule":    i,
+				"action":  filter.rule.Action,
+				"pattern": filter.rule.Topic,
+				"hits":    hits,
+			})
+			return filter.rule.Action == config.TopicFilterAllow
+		}
+	}
+	return true
+}
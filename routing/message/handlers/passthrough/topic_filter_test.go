@@ -0,0 +1,82 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicFilters(t *testing.T) {
+	settings := settings()
+	settings.TopicFilters = []config.TopicFilterRule{
+		{Action: config.TopicFilterAllow, Topic: "^test/device:edge:containers/things/twin/events/"},
+		{Action: config.TopicFilterDeny, Topic: "^test/device:edge:containers/"},
+		{Action: config.TopicFilterDeny, Topic: "/things/live/messages/debug$"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	containerEvent := `{"topic":"test/device:edge:containers/things/twin/events/modified","path":"/features/x","value":1}`
+	containerCommand := `{"topic":"test/device:edge:containers/things/twin/commands/modify","path":"/features/x","value":{"properties":{"a":1}}}`
+	debug := `{"topic":"test/device/things/live/messages/debug","path":"/outbox/messages/debug","value":1}`
+	shadow := `{"topic":"test/device/things/twin/commands/create","path":"/features/filter","value":{"properties":{"a":1}}}`
+
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "t", containerEvent)))
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", containerCommand)))
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", containerCommand)))
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", debug)))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", shadow)))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "e", `{"unknown":true}`)))
+
+	filters := messageHandler.(*deviceHandler).topicFilters
+	assert.Equal(t, uint64(1), filters[0].hits)
+	assert.Equal(t, uint64(2), filters[1].hits)
+	assert.Equal(t, uint64(1), filters[2].hits)
+}
+
+func TestTopicFiltersAllowList(t *testing.T) {
+	settings := settings()
+	settings.TopicFilters = []config.TopicFilterRule{
+		{Action: config.TopicFilterAllow, Topic: "/things/twin/"},
+		{Action: config.TopicFilterDeny, Topic: ".*"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	live := `{"topic":"test/device/things/live/messages/heatUp","path":"/inbox/messages/heatUp","value":1}`
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", live)))
+	assert.Equal(t, 1, len(handleTelemetry(t, messageHandler.HandleMessage)))
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e", `{"unknown":true}`)))
+}
+
+func TestTopicFiltersLocalTopic(t *testing.T) {
+	settings := settings()
+	settings.TopicFilters = []config.TopicFilterRule{{Action: config.TopicFilterDeny, Topic: "^e/"}}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	assert.Equal(t, 0, len(handle(t, messageHandler.HandleMessage, "e/tenant/device", "not a ditto message")))
+	assert.Equal(t, 1, len(handle(t, messageHandler.HandleMessage, "t/tenant/device", "not a ditto message")))
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// toTemplateTopic replaces the message topic with the configured topic template of the message class.
+func (h *deviceHandler) toTemplateTopic(class string, env *protocol.Envelope, msg *message.Message) {
+	template := h.eventsTopicTemplate
+	if class == config.MessageClassTelemetry {
+		template = h.telemetryTopicTemplate
+	}
+	topic, ok := connector.TopicFromCtx(msg.Context())
+	if !ok {
+		return
+	}
+	if len(template) == 0 {
+		h.toChildThingTopic(env, topic, msg)
+		return
+	}
+
+	expanded := config.ExpandTopicTemplate(template, h.templateValues(class, topic, env))
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), expanded))
+}
+
+// templateValues returns the placeholder values of the provided message class, default topic and Ditto envelope.
+func (h *deviceHandler) templateValues(class, topic string, env *protocol.Envelope) map[string]string {
+	values := map[string]string{
+		config.PlaceholderDeviceID: h.deviceID,
+		config.PlaceholderTenantID: h.tenantID,
+		config.PlaceholderClass:    class,
+	}
+	// The default topic is in format <class>/<tenantId>/<deviceId>[/<suffix>].
+	if segments := strings.Split(topic, "/"); len(segments) > 2 {
+		values[config.PlaceholderTenantID] = segments[1]
+		values[config.PlaceholderDeviceID] = segments[2]
+	}
+	if env != nil {
+		values[config.PlaceholderThingID] = fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName)
+		values[config.PlaceholderThingName] = h.thingName(values[config.PlaceholderThingID])
+		values[config.PlaceholderNamespace] = env.Topic.Namespace
+		values[config.PlaceholderEntityName] = env.Topic.EntityName
+		values[config.PlaceholderFeature] = featureFromPath(env.Path)
+		values[config.PlaceholderAction] = string(env.Topic.Action)
+		if env.Topic.Criterion == protocol.CriterionMessages {
+			values[config.PlaceholderSubject] = string(env.Topic.Action)
+		}
+	}
+	return values
+}
+
+// toChildThingTopic replaces the device ID of the default topic with the AWS IoT thing name of the child thing in gateway mode.
+func (h *deviceHandler) toChildThingTopic(env *protocol.Envelope, topic string, msg *message.Message) {
+	if env == nil || !h.gateway.GatewayMode {
+		return
+	}
+	thingName := h.thingName(fmt.Sprintf("%s:%s", env.Topic.Namespace, env.Topic.EntityName))
+	// The default topic is in format <class>/<tenantId>/<deviceId>[/<suffix>].
+	segments := strings.Split(topic, "/")
+	if len(segments) < 3 || segments[2] != h.deviceID || thingName == h.deviceID {
+		return
+	}
+	segments[2] = thingName
+	msg.SetContext(connector.SetTopicToCtx(msg.Context(), strings.Join(segments, "/")))
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicTemplates(t *testing.T) {
+	settings := settings()
+	settings.TelemetryTopicTemplate = "dt/{tenantId}/{deviceId}/{feature}"
+	settings.EventsTopicTemplate = "{class}/{namespace}/{entityName}/{action}/{subject}"
+
+	heatUp := `{"topic":"test/device/things/live/messages/heatUp","path":"/inbox/messages/heatUp","value":47}`
+	meter := `{"topic":"test/device/things/twin/events/modified","path":"/features/meter/properties/x","value":1}`
+
+	assertTopic(t, settings, "t", meter, "dt/test-tenant-id/test:device/meter")
+	assertTopic(t, settings, "e", meter, "events/test/device/modified")
+	assertTopic(t, settings, "e", heatUp, "events/test/device/heatUp/heatUp")
+	assertTopic(t, settings, "t", heatUp, "dt/test-tenant-id/test:device")
+	assertTopic(t, settings, "e", `{"unknown":true}`, "events")
+}
+
+func TestTopicTemplatesBasicIngest(t *testing.T) {
+	settings := settings()
+	settings.TelemetryTopicTemplate = "dt/{thingId}"
+	settings.BasicIngestRules = []config.BasicIngestRule{
+		{RuleName: "meter", Feature: "^meter$"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	meter := `{"topic":"test/device/things/twin/events/modified","path":"/features/meter/properties/x","value":1}`
+	assertTopic(t, settings, "t", meter, "$aws/rules/meter/dt/test:device")
+}
+
+func TestTopicTemplatesGatewayMode(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	settings.ChildThingNameTemplate = "{deviceId}-{childId}"
+
+	child := `{"topic":"test/device:door/things/twin/events/modified","path":"/features/lock/properties/x","value":1}`
+	device := `{"topic":"test/device/things/twin/events/modified","path":"/features/lock/properties/x","value":1}`
+
+	assertTopic(t, settings, "e", child, "event/test-tenant-id/test:device-door")
+	assertTopic(t, settings, "t", device, "telemetry/test-tenant-id/test:device")
+
+	settings.EventsTopicTemplate = "dt/{thingName}/{feature}"
+	assertTopic(t, settings, "e", child, "dt/test:device-door/lock")
+	assertTopic(t, settings, "e", device, "dt/test:device/lock")
+}
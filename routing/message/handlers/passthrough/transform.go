@@ -0,0 +1,192 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+)
+
+// transform applies the matching transformation rules, in order, to the provided thing data.
+func (h *deviceHandler) transform(env *protocol.Envelope, data interface{}) interface{} {
+	topic := env.Topic.String()
+	for i := range h.transformations {
+		if rule := &h.transformations[i]; rule.Matches(topic, env.Path) {
+			h.Debug("Apply payload transformation", map[string]interface{}{
+				"operation": rule.Operation,
+				"field":     rule.Field,
+			})
+			applyTransformation(rule, data)
+		}
+	}
+	return data
+}
+
+// rewriteMessage applies the matching transformation rules and, for telemetry, the deadband rules
+// to the envelope value of the non-shadow message. Returns false if the envelope value was removed.
+func (h *deviceHandler) rewriteMessage(class string, env *protocol.Envelope, msg *message.Message) (*message.Message, bool) {
+	suppress := class == config.MessageClassTelemetry && h.deadband != nil
+	if len(h.transformations) == 0 && !suppress {
+		return msg, true
+	}
+
+	path := splitPath(env.Path)
+	data := h.transform(env, integrate(path, env.Value))
+	if suppress {
+		var ok bool
+		if data, ok = h.suppress(env, data, false); !ok {
+			return nil, false
+		}
+	}
+	value, ok := extract(path, data)
+	if !ok {
+		h.Debug("Excluded message with transformed value", map[string]interface{}{"topic": env.Topic.String()})
+		return nil, false
+	}
+	env.Value = value
+
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return msg, true
+	}
+	rewritten := message.NewMessage(msg.UUID, payload)
+	for key, value := range msg.Metadata {
+		rewritten.Metadata.Set(key, value)
+	}
+	rewritten.SetContext(msg.Context())
+	return rewritten, true
+}
+
+// applyTransformation applies the transformation rule to the fields of the thing data, matching the rule field path.
+func applyTransformation(rule *config.TransformRule, data interface{}) {
+	field := splitPath(rule.Field)
+
+	switch rule.Operation {
+	case config.TransformRemove:
+		visit(data, field, false, func(parent map[string]interface{}, key string) {
+			delete(parent, key)
+		})
+
+	case config.TransformSet:
+		visit(data, field, true, func(parent map[string]interface{}, key string) {
+			parent[key] = copyValue(rule.Value)
+		})
+
+	case config.TransformRename:
+		visit(data, field, false, func(parent map[string]interface{}, key string) {
+			value := parent[key]
+			delete(parent, key)
+			parent[rule.Target] = value
+		})
+
+	case config.TransformMove:
+		values := []interface{}{}
+		visit(data, field, false, func(parent map[string]interface{}, key string) {
+			values = append(values, parent[key])
+			delete(parent, key)
+		})
+		for _, value := range values {
+			visit(data, splitPath(rule.Target), true, func(parent map[string]interface{}, key string) {
+				parent[key] = value
+			})
+		}
+
+	case config.TransformConvert:
+		visit(data, field, false, func(parent map[string]interface{}, key string) {
+			if number, ok := parent[key].(float64); ok {
+				parent[key] = number*rule.Scale + rule.Offset
+			}
+		})
+	}
+}
+
+// visit calls the provided function with the parent object and key of each field matching the path levels.
+// Missing objects are created, if requested and the path level is not a wildcard.
+func visit(data interface{}, path []string, create bool, fn func(map[string]interface{}, string)) {
+	object, ok := data.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+
+	key := path[0]
+	if key == config.TransformWildcard {
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if len(path) == 1 {
+				fn(object, k)
+			} else {
+				visit(object[k], path[1:], create, fn)
+			}
+		}
+		return
+	}
+
+	child, exists := object[key]
+	if len(path) == 1 {
+		if exists || create {
+			fn(object, key)
+		}
+		return
+	}
+	if !exists && create {
+		child = map[string]interface{}{}
+		object[key] = child
+	}
+	visit(child, path[1:], create, fn)
+}
+
+// extract returns the value of the provided path levels.
+func extract(path []string, data interface{}) (interface{}, bool) {
+	for _, key := range path {
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if data, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// splitPath returns the non-empty levels of the slash separated path.
+func splitPath(path string) []string {
+	levels := []string{}
+	for _, level := range strings.Split(path, "/") {
+		if len(level) > 0 {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// copyValue returns a deep copy of the configured JSON value.
+func copyValue(value interface{}) interface{} {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var copied interface{}
+	if err := json.Unmarshal(raw, &copied); err != nil {
+		return value
+	}
+	return copied
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package passthrough
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eclipse-kanto/aws-connector/config"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/eclipse-kanto/suite-connector/connector"
+	"github.com/eclipse/ditto-clients-golang/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformShadow(t *testing.T) {
+	settings := settings()
+	settings.Transformations = []config.TransformRule{
+		{Operation: config.TransformRename, Field: "/features/*/properties/temp", Target: "temperature"},
+		{Operation: config.TransformConvert, Field: "/features/*/properties/temperature", Scale: 1.8, Offset: 32},
+		{Operation: config.TransformSet, Field: "/features/climate/properties/unit", Value: "F"},
+		{Operation: config.TransformRemove, Field: "/features/climate/properties/debug"},
+		{Operation: config.TransformSet, Topic: "^other/", Field: "/features/climate/properties/other", Value: true},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	payload := `{
+		"topic":"test/device/things/twin/commands/create",
+		"path":"/features/climate",
+		"value":{"properties":{"temp":20,"debug":{"trace":1}}}
+	}`
+	topic, payload := requireValidMessageSettings(t, settings, "event", payload)
+	assert.Equal(t, "$aws/things/test:device/shadow/name/climate/update", topic)
+	assert.JSONEq(t, `{"state":{"reported":{"temperature":68,"unit":"F"}}}`, payload)
+}
+
+func TestTransformMessage(t *testing.T) {
+	settings := settings()
+	settings.Transformations = []config.TransformRule{
+		{Operation: config.TransformMove, Path: "^/features/meter", Field: "/features/meter/properties/x/power", Target: "/features/meter/properties/x/kW"},
+		{Operation: config.TransformSet, Path: "^/features/meter", Field: "/features/meter/properties/x/site", Value: map[string]interface{}{"id": 1}},
+		{Operation: config.TransformSet, Path: "^/features/other", Field: "/features/meter/properties/x/unknown", Value: 1},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	payload := `{
+		"topic":"test/device/things/twin/events/modified",
+		"path":"/features/meter/properties/x",
+		"value":{"power":12.5}
+	}`
+	_, payload = requireValidMessageSettings(t, settings, "t", payload)
+	assert.Contains(t, payload, `"path":"/features/meter/properties/x"`)
+	assert.Contains(t, payload, `"value":{"kW":12.5,"site":{"id":1}}`)
+}
+
+func TestTransformMessageRemoved(t *testing.T) {
+	settings := settings()
+	settings.Transformations = []config.TransformRule{
+		{Operation: config.TransformRemove, Field: "/features/meter/properties/x"},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	assert.Equal(t, 0, len(handleTelemetry(t, messageHandler.HandleMessage)))
+}
+
+func TestTransformMessageMetadata(t *testing.T) {
+	settings := settings()
+	settings.Transformations = []config.TransformRule{
+		{Operation: config.TransformSet, Field: "/features/meter/properties/x/site", Value: 1},
+	}
+	require.NoError(t, settings.CompileFilters())
+
+	messageHandler := CreateDefaultDeviceHandler(shadowStateHolder)
+	require.NoError(t, messageHandler.Init(settings, watermill.NopLogger{}))
+
+	msg := message.NewMessage("test", nil)
+	msg.Metadata.Set("key", "value")
+	msg.SetContext(connector.SetQosToCtx(msg.Context(), connector.QosAtMostOnce))
+
+	env := &protocol.Envelope{Headers: protocol.NewHeaders()}
+	payload := `{"topic":"test/device/things/twin/events/modified","path":"/features/meter/properties/x","value":{"power":12.5}}`
+	require.NoError(t, json.Unmarshal([]byte(payload), env))
+	rewritten, ok := messageHandler.(*deviceHandler).rewriteMessage(config.MessageClassTelemetry, env, msg)
+	require.True(t, ok)
+	assert.Equal(t, "value", rewritten.Metadata.Get("key"))
+	qos, ok := connector.QosFromCtx(rewritten.Context())
+	require.True(t, ok)
+	assert.Equal(t, connector.QosAtMostOnce, qos)
+}
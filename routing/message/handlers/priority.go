@@ -0,0 +1,40 @@
+// Copyright (c) 2023 Contributors to the Eclipse Foundation
+//
+// See the NOTICE file(s) distributed with this work for additional
+// information regarding copyright ownership.
+//
+// This program and the accompanying materials are made available under the
+// terms of the Eclipse Public License 2.0 which is available at
+// https://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+// which is available at https://www.apache.org/licenses/LICENSE-2.0.
+//
+// SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+
+package handlers
+
+import (
+	"context"
+)
+
+// Priority defines the publishing priority of a message toward AWS IoT.
+type Priority int
+
+const (
+	// PriorityLow is used for messages that can be delayed or dropped, e.g. telemetry.
+	PriorityLow Priority = iota
+	// PriorityHigh is used for messages that must be sent first, e.g. shadow updates and command responses.
+	PriorityHigh
+)
+
+type priorityContextKey struct{}
+
+// SetPriorityToCtx adds the publishing priority to the provided context.
+func SetPriorityToCtx(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, priority)
+}
+
+// PriorityFromCtx returns the publishing priority.
+func PriorityFromCtx(ctx context.Context) (Priority, bool) {
+	priority, ok := ctx.Value(priorityContextKey{}).(Priority)
+	return priority, ok
+}
@@ -36,6 +36,7 @@ var shadows = make(map[string]interface{})
 type shadowStateHandler struct {
 	tenantID string
 	deviceID string
+	gateway  bool
 	logger   watermill.LoggerAdapter
 	topics   string
 }
@@ -50,9 +51,14 @@ func CreateDefaultShadowStateHandler() handlers.MessageHandler {
 func (h *shadowStateHandler) Init(settings *config.CloudSettings, logger watermill.LoggerAdapter) error {
 	h.tenantID = settings.TenantID
 	h.deviceID = settings.DeviceID
+	h.gateway = settings.GatewayMode
 	h.logger = logger
 
 	topicBase := fmt.Sprintf(topicBaseTemplate, settings.DeviceID)
+	if h.gateway {
+		// In gateway mode the child things are represented by their own AWS IoT things.
+		topicBase = fmt.Sprintf(topicBaseTemplate, "+")
+	}
 	rootShadowUpdatedTopic := fmt.Sprint(topicBase, updateSuffix)
 	rootShadowDeletedTopic := fmt.Sprint(topicBase, deleteSuffix)
 	childShadowUpdatedTopic := fmt.Sprint(topicBase, namedShadowAdditionTopicTemplate, updateSuffix)
@@ -123,13 +129,23 @@ func find(name string, values interface{}) (interface{}, bool) {
 }
 
 func (h shadowStateHandler) getShadowID(topic string) string {
+	const thingNameIndex = 2
 	const shadowIDIndex = 5
 
+	segments := strings.Split(topic, "/")
+	if h.gateway && segments[thingNameIndex] != h.deviceID {
+		// The shadows of the child things are kept under <THING_NAME> and <THING_NAME>/<SHADOW_NAME>.
+		if !strings.Contains(topic, "/name/") {
+			return segments[thingNameIndex]
+		}
+		return segments[thingNameIndex] + "/" + segments[shadowIDIndex]
+	}
+
 	if !strings.Contains(topic, "/name/") {
 		return h.deviceID
 	}
 
-	return strings.Split(topic, "/")[shadowIDIndex]
+	return segments[shadowIDIndex]
 }
 
 // Name returns the name of the message handler.
@@ -106,6 +106,28 @@ func TestDeleteChildShadow(t *testing.T) {
 	assertDeleteShadow(t, "$aws/things/test:device/shadow/name/test:device:child", "test:device:child")
 }
 
+func TestGatewayModeShadows(t *testing.T) {
+	settings := settings()
+	settings.GatewayMode = true
+	handler := CreateDefaultShadowStateHandler()
+	require.NoError(t, handler.Init(settings, watermill.NopLogger{}))
+	assert.Equal(t, "$aws/things/+/shadow/update/accepted,$aws/things/+/shadow/delete/accepted,$aws/things/+/shadow/name/+/update/accepted,$aws/things/+/shadow/name/+/delete/accepted", handler.Topics())
+
+	shadowHolder := handler.(passthrough.ShadowStateHolder)
+	for topic, shadowID := range map[string]string{
+		"$aws/things/test:device/shadow/update/accepted":                 "test:device",
+		"$aws/things/test:device/shadow/name/lamp/update/accepted":       "lamp",
+		"$aws/things/test:device:child/shadow/update/accepted":           "test:device:child",
+		"$aws/things/test:device:child/shadow/name/lamp/update/accepted": "test:device:child/lamp",
+	} {
+		message := &message.Message{Payload: []byte(validPayload)}
+		message.SetContext(connector.SetTopicToCtx(message.Context(), topic))
+		_, err := handler.HandleMessage(message)
+		require.NoError(t, err)
+		assert.Equal(t, expectedShadowState, shadowHolder.GetCurrentShadowState(shadowID), topic)
+	}
+}
+
 func assertErrorWhenUpdatingAndPayloadIncorrect(t *testing.T, payload string) {
 	handler, message := setUp(payload, "$aws/things/test:device/shadow/update/accepted")
 	result, err := handler.HandleMessage(message)